@@ -2,12 +2,18 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/adrg/xdg"
 	humanize "github.com/dustin/go-humanize"
@@ -45,42 +51,161 @@ func init() {
 }
 
 var (
-	configPath string
+	configPath       string
+	syncJobs         int
+	syncFailFast     bool
+	pruneQuarantine  bool
+	pruneDelete      bool
+	pruneGracePeriod time.Duration
 )
 
+// defaultPruneGracePeriod is used when neither the configuration nor flags specify one.
+const defaultPruneGracePeriod = 7 * 24 * time.Hour
+
+// exitCodeSyncFailures is used when at least one repository failed to sync. It differs from the
+// generic failure code so that automation can tell partial failures apart.
+const exitCodeSyncFailures = 2
+
+var errSyncFailures = errors.New("some repositories failed to sync")
+
 func main() {
-	ctx := context.Background()
+	// Interrupting cancels the context, which stops all in-flight git processes.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 
 	syncCmd := &cobra.Command{
 		Use:   "sync",
 		Short: "Sync repositories",
 		Args:  cobra.MaximumNArgs(0),
 		RunE: func(_ *cobra.Command, _ []string) error {
-			syncables, err := gatherSyncables(ctx)
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			syncables, err := gatherSyncables(ctx, config)
+			if err != nil {
+				return err
+			}
+			failures, err := gitfetcher.SyncAll(ctx, syncables, syncOptions(config))
+			if err != nil {
+				return err
+			}
+			if len(failures) > 0 {
+				printSyncFailures(os.Stderr, failures)
+				return fmt.Errorf("%w (%v of %v)", errSyncFailures, len(failures), len(syncables))
+			}
+			return nil
+		},
+	}
+	syncCmd.Flags().IntVarP(&syncJobs, "jobs", "j", 0, "number of repositories to sync concurrently")
+	syncCmd.Flags().BoolVar(&syncFailFast, "fail-fast", false, "stop at the first failing repository")
+
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show actions sync would perform, without performing them",
+		Args:  cobra.MaximumNArgs(0),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			config, err := loadConfig()
 			if err != nil {
 				return err
 			}
+			syncables, err := gatherSyncables(ctx, config)
+			if err != nil {
+				return err
+			}
+			opts := syncOptions(config)
+			var failures []*gitfetcher.SyncError
 			for _, syncable := range syncables {
-				if err := syncable.Sync(ctx); err != nil {
+				actions, err := syncable.Plan(ctx, opts)
+				var serr *gitfetcher.SyncError
+				if errors.As(err, &serr) {
+					// As when syncing, a failing repository doesn't prevent planning the others.
+					failures = append(failures, serr)
+				} else if err != nil {
 					return err
 				}
+				status, layout := syncable.SyncStatus(), syncable.Layout()
+				fmt.Printf("%v\t%s\t%s\n", status, layout, syncable.RootDir()) //nolint:forbidigo
+				for _, action := range actions {
+					fmt.Printf("\t%s\n", action) //nolint:forbidigo
+				}
+			}
+			if len(failures) > 0 {
+				printSyncFailures(os.Stderr, failures)
+				return fmt.Errorf("%w (%v of %v)", errSyncFailures, len(failures), len(syncables))
 			}
 			return nil
 		},
 	}
 
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "List, quarantine, or delete repositories without source",
+		Args:  cobra.MaximumNArgs(0),
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			syncables, err := gatherSyncables(ctx, config)
+			if err != nil {
+				return err
+			}
+			pruneCfg := config.GetOptions().GetPrune()
+			opts := gitfetcher.PruneOptions{
+				Root:          config.GetOptions().GetRoot(),
+				QuarantineDir: pruneCfg.GetQuarantineDir(),
+				GracePeriod:   defaultPruneGracePeriod,
+			}
+			if d := pruneCfg.GetGracePeriod(); d != nil {
+				opts.GracePeriod = d.AsDuration()
+			}
+			if cmd.Flags().Changed("grace-period") {
+				opts.GracePeriod = pruneGracePeriod
+			}
+			switch {
+			case pruneQuarantine:
+				opts.Action = gitfetcher.PruneActionQuarantine
+			case pruneDelete:
+				opts.Action = gitfetcher.PruneActionDelete
+			}
+			orphans, err := gitfetcher.Prune(syncables, opts)
+			for _, orphan := range orphans {
+				action := "kept"
+				if orphan.Pruned {
+					action = "pruned"
+				}
+				fmt.Printf("%s\t%s\t%s\n", action, orphan.RootDir, humanize.Time(orphan.Since)) //nolint:forbidigo
+			}
+			return err
+		},
+	}
+	pruneCmd.Flags().BoolVar(&pruneQuarantine, "quarantine", false, "move orphaned repositories")
+	pruneCmd.Flags().BoolVar(&pruneDelete, "delete", false, "delete orphaned repositories")
+	pruneCmd.Flags().DurationVar(
+		&pruneGracePeriod, "grace-period", 0, "minimum time orphaned before pruning",
+	)
+	pruneCmd.MarkFlagsMutuallyExclusive("quarantine", "delete")
+
 	statusCmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show repository statuses",
 		Args:  cobra.MaximumNArgs(0),
 		RunE: func(_ *cobra.Command, _ []string) error {
-			syncables, err := gatherSyncables(ctx)
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			syncables, err := gatherSyncables(ctx, config)
 			if err != nil {
 				return err
 			}
 			for _, syncable := range syncables {
 				status := syncable.SyncStatus()
-				fmt.Printf("%v\t%s\t%s\n", status, syncable.RootDir(), humanize.Time(syncable.LastSyncedAt())) //nolint:forbidigo
+				worktree, err := syncable.WorktreeState(ctx)
+				if err != nil {
+					slog.Warn("Unable to get worktree state.", except.LogErrAttr(err))
+				}
+				fmt.Printf("%v\t%s\t%s\t%v\n", status, syncable.RootDir(), humanize.Time(syncable.LastSyncedAt()), worktree) //nolint:forbidigo
 			}
 			return nil
 		},
@@ -90,24 +215,49 @@ func main() {
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
 	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "path to configuration")
-	rootCmd.AddCommand(syncCmd, statusCmd)
+	rootCmd.AddCommand(syncCmd, planCmd, pruneCmd, statusCmd)
 
-	if err := rootCmd.ExecuteContext(ctx); err != nil {
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if errors.Is(err, errSyncFailures) {
+		os.Exit(exitCodeSyncFailures)
+	} else if err != nil {
 		os.Exit(1)
 	}
 }
 
-func gatherSyncables(ctx context.Context) ([]gitfetcher.Syncable, error) {
-	config, err := loadConfig()
-	if err != nil {
-		return nil, err
+func syncOptions(config *gitfetcher.Config) gitfetcher.SyncOptions {
+	opts := config.GetOptions()
+	return gitfetcher.SyncOptions{
+		Jobs:         cmp.Or(syncJobs, int(opts.GetJobs()), 1),
+		FailFast:     syncFailFast,
+		Retry:        gitfetcher.NewRetryPolicy(opts.GetRetry()),
+		FetchTimeout: opts.GetFetchTimeout().AsDuration(),
+		Clone:        gitfetcher.NewCloneSettings(opts.GetClone()),
+		History:      gitfetcher.NewHistorySettings(opts.GetHistory()),
+	}
+}
+
+func printSyncFailures(w io.Writer, failures []*gitfetcher.SyncError) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "GITDIR\tSTEP\tERROR")
+	for _, failure := range failures {
+		msg := strings.Join(strings.Fields(failure.Err.Error()), " ")
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", failure.GitDir, failure.Step, msg)
 	}
+	tw.Flush()
+}
+
+func gatherSyncables(
+	ctx context.Context,
+	config *gitfetcher.Config,
+) ([]gitfetcher.Syncable, error) {
 	root := config.GetOptions().GetRoot()
 	targets, err := gitfetcher.FindTargets(root)
 	if err != nil {
 		return nil, err
 	}
-	sources, err := gitfetcher.LoadSources(ctx, config.GetSources())
+	sources, err := gitfetcher.LoadSources(ctx, config.GetSources(), config.GetOptions())
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package gitfetcher
+
+import "os/exec"
+
+// killProcessGroupOnCancel is a no-op on platforms without process groups, the command itself is
+// still killed when its context is done.
+func killProcessGroupOnCancel(_ *exec.Cmd) {}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package gitfetcher
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel runs the command in its own process group and kills the whole group when
+// the command's context is done. This also stops any helpers git spawned, for example
+// git-remote-https, which would otherwise keep running.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 
 	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
 	"github.com/mtth/gitfetcher/internal/except"
@@ -79,6 +80,10 @@ func readConfig(fpath fspath.Local) (*configpb.Config, error) {
 		return nil, fmt.Errorf("%w: %v", errInvalidConfig, err)
 	}
 	ensureRootAbsolute(&cfg, filepath.Dir(fpath))
+	ensureSourcePathsAbsolute(&cfg, filepath.Dir(fpath))
+	if prune := cfg.GetOptions().GetPrune(); prune != nil {
+		prune.QuarantineDir = absolutePath(filepath.Dir(fpath), prune.GetQuarantineDir())
+	}
 	return &cfg, nil
 }
 
@@ -94,3 +99,40 @@ func ensureRootAbsolute(cfg *configpb.Config, dpath fspath.Local) {
 	except.Must(err == nil, "can't make path %v absolute: %v", dpath, err)
 	cfg.Options.Root = path.Join(filepath.ToSlash(base), root)
 }
+
+// ensureSourcePathsAbsolute resolves file paths referenced by sources relative to dpath.
+func ensureSourcePathsAbsolute(cfg *configpb.Config, dpath fspath.Local) {
+	for _, src := range cfg.GetSources() {
+		var appAuth *configpb.GithubAppAuth
+		switch b := src.GetBranch().(type) {
+		case *configpb.Source_FromGithubToken:
+			appAuth = b.FromGithubToken.GetAppAuth()
+		case *configpb.Source_FromGithubOrg:
+			appAuth = b.FromGithubOrg.GetAppAuth()
+		case *configpb.Source_FromGithubSearch:
+			appAuth = b.FromGithubSearch.GetAppAuth()
+		}
+		if appAuth != nil {
+			appAuth.PrivateKeyPath = absolutePath(dpath, appAuth.GetPrivateKeyPath())
+		}
+		if manifest := src.GetFromManifest(); manifest != nil {
+			manifest.Path = absolutePath(dpath, manifest.GetPath())
+		}
+		if localDir := src.GetFromLocalDir(); localDir != nil {
+			localDir.Path = absolutePath(dpath, localDir.GetPath())
+		}
+		if cmd := src.GetFromCommand().GetCommand(); len(cmd) > 0 && strings.Contains(cmd[0], "/") {
+			// Bare program names are looked up in PATH, so we only resolve explicit paths.
+			cmd[0] = absolutePath(dpath, cmd[0])
+		}
+	}
+}
+
+func absolutePath(dpath, fpath fspath.Local) fspath.Local {
+	if fpath == "" || filepath.IsAbs(fpath) {
+		return fpath
+	}
+	base, err := filepathAbs(dpath)
+	except.Must(err == nil, "can't make path %v absolute: %v", dpath, err)
+	return filepath.Join(base, fpath)
+}
@@ -97,3 +97,64 @@ func TestFindConfig(t *testing.T) {
 		assert.Len(t, got.GetSources(), 2)
 	})
 }
+
+func TestEnsureSourcePathsAbsolute(t *testing.T) {
+	cfg := &configpb.Config{
+		Sources: []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubToken{
+				FromGithubToken: &configpb.GithubTokenSource{
+					AppAuth: &configpb.GithubAppAuth{PrivateKeyPath: "keys/app.pem"},
+				},
+			},
+		}, {
+			Branch: &configpb.Source_FromGithubOrg{
+				FromGithubOrg: &configpb.GithubOrgSource{
+					AppAuth: &configpb.GithubAppAuth{PrivateKeyPath: "/abs/app.pem"},
+				},
+			},
+		}, {
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{Command: []string{"./list.sh", "./arg"}},
+			},
+		}, {
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{Command: []string{"list"}},
+			},
+		}, {
+			Branch: &configpb.Source_FromManifest{
+				FromManifest: &configpb.ManifestSource{Path: "repos.txt"},
+			},
+		}, {
+			Branch: &configpb.Source_FromLocalDir{
+				FromLocalDir: &configpb.LocalDirSource{Path: "../checkouts"},
+			},
+		}},
+	}
+	ensureSourcePathsAbsolute(cfg, "/etc/gitfetcher")
+	assert.Equal(
+		t,
+		filepath.Join("/etc/gitfetcher", "keys", "app.pem"),
+		cfg.GetSources()[0].GetFromGithubToken().GetAppAuth().GetPrivateKeyPath(),
+	)
+	assert.Equal(
+		t,
+		"/abs/app.pem",
+		cfg.GetSources()[1].GetFromGithubOrg().GetAppAuth().GetPrivateKeyPath(),
+	)
+	assert.Equal(
+		t,
+		[]string{filepath.Join("/etc/gitfetcher", "list.sh"), "./arg"},
+		cfg.GetSources()[2].GetFromCommand().GetCommand(),
+	)
+	assert.Equal(t, []string{"list"}, cfg.GetSources()[3].GetFromCommand().GetCommand())
+	assert.Equal(
+		t,
+		filepath.Join("/etc/gitfetcher", "repos.txt"),
+		cfg.GetSources()[4].GetFromManifest().GetPath(),
+	)
+	assert.Equal(
+		t,
+		filepath.Join("/etc", "checkouts"),
+		cfg.GetSources()[5].GetFromLocalDir().GetPath(),
+	)
+}
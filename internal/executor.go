@@ -0,0 +1,103 @@
+package gitfetcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mtth/gitfetcher/internal/fspath"
+	"github.com/mtth/gitfetcher/internal/source"
+)
+
+// executor performs the side effects of a sync. This allows planning syncs without running them.
+type executor interface {
+	// runGit runs a git command, panicking if it fails.
+	runGit(ctx context.Context, cwd fspath.Local, args []string)
+	// mkdirAll creates a directory and any missing parents.
+	mkdirAll(fp fspath.Local) error
+	// writeFile creates or overwrites a file.
+	writeFile(fp fspath.Local, contents string) error
+	// removeFile removes a file.
+	removeFile(fp fspath.Local) error
+	// rename moves a file or directory.
+	rename(from, to fspath.Local) error
+	// fetchFlags returns the flags to use when fetching from a source, including credentials.
+	fetchFlags(ctx context.Context, src *source.Source) ([]string, error)
+}
+
+// systemExecutor performs side effects.
+type systemExecutor struct{}
+
+func (systemExecutor) runGit(ctx context.Context, cwd fspath.Local, args []string) {
+	runGitCommand(ctx, cwd, args)
+}
+
+func (systemExecutor) mkdirAll(fp fspath.Local) error {
+	return os.MkdirAll(fp, 0755)
+}
+
+func (systemExecutor) writeFile(fp fspath.Local, contents string) error {
+	return os.WriteFile(fp, []byte(contents), 0644)
+}
+
+func (systemExecutor) removeFile(fp fspath.Local) error {
+	return os.Remove(fp)
+}
+
+func (systemExecutor) rename(from, to fspath.Local) error {
+	return os.Rename(from, to)
+}
+
+func (systemExecutor) fetchFlags(ctx context.Context, src *source.Source) ([]string, error) {
+	return src.ResolveFetchFlags(ctx)
+}
+
+// planExecutor records side effects instead of performing them.
+type planExecutor struct {
+	actions []string
+}
+
+func (e *planExecutor) runGit(_ context.Context, _ fspath.Local, args []string) {
+	e.actions = append(e.actions, "git "+strings.Join(args, " "))
+}
+
+func (e *planExecutor) mkdirAll(fp fspath.Local) error {
+	e.actions = append(e.actions, "mkdir -p "+fp)
+	return nil
+}
+
+func (e *planExecutor) writeFile(fp fspath.Local, contents string) error {
+	e.actions = append(e.actions, fmt.Sprintf("write %s (%d bytes)", fp, len(contents)))
+	return nil
+}
+
+func (e *planExecutor) removeFile(fp fspath.Local) error {
+	e.actions = append(e.actions, "rm "+fp)
+	return nil
+}
+
+func (e *planExecutor) rename(from, to fspath.Local) error {
+	e.actions = append(e.actions, fmt.Sprintf("mv %s %s", from, to))
+	return nil
+}
+
+// fetchFlags never returns credentials, to avoid both minting short-lived ones and displaying
+// them.
+func (e *planExecutor) fetchFlags(context.Context, *source.Source) ([]string, error) {
+	return nil, nil
+}
+
+// Plan returns the actions Sync would perform, without performing them. Fetch actions omit any
+// credentials.
+func (s *Syncable) Plan(ctx context.Context, opts SyncOptions) ([]string, error) {
+	var exec planExecutor
+	opts.executor = &exec
+	err := catchSyncStep(func() { s.syncSteps(ctx, opts, s.SyncStatus()) })
+	var serr *SyncError
+	if errors.As(err, &serr) {
+		serr.GitDir = s.GitDir
+	}
+	return exec.actions, err
+}
@@ -0,0 +1,101 @@
+package gitfetcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/effect"
+	"github.com/mtth/gitfetcher/internal/source"
+	"github.com/mtth/gitfetcher/internal/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncable_Plan(t *testing.T) {
+	defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+		t.Fatalf("unexpected git command: %v", args)
+	})()
+
+	syncables, err := GatherSyncables(
+		nil,
+		[]source.Source{{
+			FullName:      "cool/test",
+			FetchURL:      "http://example.com/test",
+			FetchFlags:    []string{"-c", "credential.helper=secret"},
+			DefaultBranch: "main",
+			Description:   "A test",
+		}},
+		"/tmp",
+		configpb.Options_BARE_LAYOUT,
+	)
+	require.NoError(t, err)
+	require.Len(t, syncables, 1)
+
+	actions, err := syncables[0].Plan(context.Background(), SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "bare", syncables[0].Layout())
+	assert.Equal(t, []string{
+		"mkdir -p /tmp/cool/test.git",
+		"git init -b main --bare",
+		"git remote add origin http://example.com/test",
+		"git config set gitweb.url http://example.com/test",
+		"git config set gitweb.extraBranchRefs remotes",
+		"write /tmp/cool/test.git/description (6 bytes)",
+		"git fetch --all",
+		"git update-ref refs/heads/main refs/remotes/origin/main",
+		"git symbolic-ref HEAD refs/heads/main",
+	}, actions)
+	assert.NoDirExists(t, "/tmp/cool/test.git")
+}
+
+func TestSyncable_Plan_relocated(t *testing.T) {
+	for _, key := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_"+key+"_NAME", "Ann")
+		t.Setenv("GIT_"+key+"_EMAIL", "ann@example.com")
+	}
+	root := t.TempDir()
+	upstream := filepath.Join(root, "upstream")
+	require.NoError(t, os.Mkdir(upstream, 0755))
+	git(t, upstream, "init", "-b", "main")
+	commitFile(t, upstream, "a.txt", "1")
+	commitFile(t, upstream, "a.txt", "2")
+	fetchURL := "file://" + filepath.ToSlash(upstream)
+	git(t, root, "clone", "--depth", "1", "--no-single-branch", fetchURL, "old")
+	oldDir := filepath.Join(root, "old")
+	git(t, oldDir, "config", "gitfetcher.sourceId", "test:1")
+	tgt, err := target.FromPath(oldDir)
+	require.NoError(t, err)
+
+	syncables, err := GatherSyncables(
+		[]target.Target{tgt},
+		[]source.Source{{
+			FullName:      "new",
+			ID:            "test:1",
+			FetchURL:      fetchURL,
+			DefaultBranch: "main",
+		}},
+		root,
+		configpb.Options_DEFAULT_LAYOUT,
+	)
+	require.NoError(t, err)
+	require.Len(t, syncables, 1)
+
+	// The plan reflects the target's state at its previous location.
+	actions, err := syncables[0].Plan(context.Background(), SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"mkdir -p " + root,
+		fmt.Sprintf("mv %s %s", oldDir, filepath.Join(root, "new")),
+		"git remote set-url origin " + fetchURL,
+		"git config set gitweb.url " + fetchURL,
+		"git config set gitweb.extraBranchRefs remotes",
+		"git config set gitfetcher.sourceId test:1",
+		"git fetch --all --update-shallow",
+		"git merge --ff-only refs/remotes/origin/main",
+	}, actions)
+	assert.NoDirExists(t, filepath.Join(root, "new"))
+}
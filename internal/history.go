@@ -0,0 +1,109 @@
+package gitfetcher
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/target"
+)
+
+const (
+	// historyRefPrefix is the namespace of backups of refs rewritten or deleted upstream. Backup
+	// names are the original ref's, without its refs/ prefix, under a timestamp.
+	historyRefPrefix = "refs/gitfetcher/history/"
+
+	// historyTimeFormat is the format of backup timestamps. Ref names may not contain colons.
+	historyTimeFormat = "20060102T150405Z"
+)
+
+// HistorySettings configures backups of refs rewritten or deleted upstream.
+type HistorySettings struct {
+	// Minimum duration for which backups are kept. Zero to keep them forever.
+	Retention time.Duration
+}
+
+// NewHistorySettings returns settings matching the configuration, or nil if it is nil.
+func NewHistorySettings(cfg *configpb.HistoryOptions) *HistorySettings {
+	if cfg == nil {
+		return nil
+	}
+	return &HistorySettings{Retention: cfg.GetRetention().AsDuration()}
+}
+
+// readRefs returns a snapshot of the target's refs.
+func (s *Syncable) readRefs() map[string]string {
+	refs, err := target.ReadRefs(s.currentGitDir())
+	checkSyncStep("read refs", err)
+	return refs
+}
+
+// preserveHistory backs up the previous tips of refs which a fetch rewrote or deleted, given a
+// snapshot of refs taken before it. It also deletes expired backups.
+func (s *Syncable) preserveHistory(
+	ctx context.Context,
+	opts SyncOptions,
+	before map[string]string,
+) {
+	after := s.readRefs()
+	now := timeNow().UTC()
+	stamp, retention := now.Format(historyTimeFormat), opts.History.Retention
+	for _, name := range slices.Sorted(maps.Keys(before)) {
+		oid := before[name]
+		if !s.isHistoryTracked(name) {
+			continue
+		}
+		if tip, ok := after[name]; ok && (tip == oid || s.isAncestor(ctx, opts, oid, tip)) {
+			continue
+		}
+		backup := historyRefPrefix + stamp + "/" + strings.TrimPrefix(name, "refs/")
+		s.logger().Info("Preserving rewritten ref.", slog.String("ref", name), slog.String("to", backup))
+		s.runGit(ctx, opts, "update-ref", backup, oid)
+	}
+	for _, name := range slices.Sorted(maps.Keys(after)) {
+		if isExpiredHistoryRef(name, now, retention) {
+			s.runGit(ctx, opts, "update-ref", "-d", name)
+		}
+	}
+}
+
+// isHistoryTracked returns true iff the ref mirrors a remote one, and should be backed up when
+// rewritten.
+func (s *Syncable) isHistoryTracked(name string) bool {
+	if s.isMirror() {
+		return !strings.HasPrefix(name, historyRefPrefix)
+	}
+	return strings.HasPrefix(name, "refs/remotes/"+target.DefaultRemote+"/")
+}
+
+// isAncestor returns true iff the first object is an ancestor of the second. Objects which can't be
+// compared, for example because one is missing from a shallow clone, are not considered ancestors.
+func (s *Syncable) isAncestor(ctx context.Context, opts SyncOptions, oid, descendant string) bool {
+	err := catchSyncStep(func() {
+		s.runGit(ctx, opts, "merge-base", "--is-ancestor", oid, descendant)
+	})
+	var cerr *commandError
+	if errors.As(err, &cerr) {
+		return false
+	} else if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// isExpiredHistoryRef returns true iff the ref is a backup older than the retention. Backups are
+// never expired if the retention is zero.
+func isExpiredHistoryRef(name string, now time.Time, retention time.Duration) bool {
+	rest, ok := strings.CutPrefix(name, historyRefPrefix)
+	if !ok || retention <= 0 {
+		return false
+	}
+	stamp, _, _ := strings.Cut(rest, "/")
+	created, err := time.Parse(historyTimeFormat, stamp)
+	return err == nil && now.Sub(created) > retention
+}
@@ -0,0 +1,86 @@
+package gitfetcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mtth/gitfetcher/internal/effect"
+	"github.com/mtth/gitfetcher/internal/source"
+	"github.com/mtth/gitfetcher/internal/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncable_preserveHistory(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	defer effect.Swap(&timeNow, func() time.Time { return t0 })()
+
+	var cmds []string
+	defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+		cmds = append(cmds, strings.Join(args, " "))
+		if args[0] == "merge-base" && args[2] == "ccc" {
+			checkSyncStep("git merge-base", &commandError{err: os.ErrInvalid})
+		}
+	})()
+
+	root := t.TempDir()
+	gitDir := filepath.Join(root, "cool/repo/.git")
+	for name, oid := range map[string]string{
+		"refs/heads/main":          "aaa",
+		"refs/remotes/origin/main": "bbb",
+		"refs/remotes/origin/push": "ddd",
+		"refs/remotes/origin/same": "fff",
+		"refs/gitfetcher/history/20240101T000000Z/remotes/origin/old": "111",
+	} {
+		fp := filepath.Join(gitDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		require.NoError(t, os.WriteFile(fp, []byte(oid+"\n"), 0644))
+	}
+	var tgt target.Target = fakeTarget{path: filepath.Join(root, "cool/repo")}
+	syncable := Syncable{
+		GitDir: gitDir,
+		target: &tgt,
+		source: &source.Source{FullName: "cool/repo"},
+	}
+
+	syncable.preserveHistory(ctx, SyncOptions{History: &HistorySettings{Retention: 7 * 24 * time.Hour}},
+		map[string]string{
+			"refs/heads/main":          "zzz",
+			"refs/remotes/origin/gone": "eee",
+			"refs/remotes/origin/main": "aaa",
+			"refs/remotes/origin/push": "ccc",
+			"refs/remotes/origin/same": "fff",
+			"refs/gitfetcher/history/20240101T000000Z/remotes/origin/old": "111",
+		})
+	assert.Equal(t, []string{
+		"update-ref refs/gitfetcher/history/20240201T120000Z/remotes/origin/gone eee",
+		"merge-base --is-ancestor aaa bbb",
+		"merge-base --is-ancestor ccc ddd",
+		"update-ref refs/gitfetcher/history/20240201T120000Z/remotes/origin/push ccc",
+		"update-ref -d refs/gitfetcher/history/20240101T000000Z/remotes/origin/old",
+	}, cmds)
+}
+
+func TestIsExpiredHistoryRef(t *testing.T) {
+	now := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	for name, tc := range map[string]struct {
+		ref       string
+		retention time.Duration
+		want      bool
+	}{
+		"expired":       {"refs/gitfetcher/history/20240101T000000Z/heads/main", time.Hour, true},
+		"recent":        {"refs/gitfetcher/history/20240131T235959Z/heads/main", time.Hour, false},
+		"no retention":  {"refs/gitfetcher/history/20240101T000000Z/heads/main", 0, false},
+		"invalid stamp": {"refs/gitfetcher/history/latest/heads/main", time.Hour, false},
+		"not a backup":  {"refs/heads/main", time.Hour, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, isExpiredHistoryRef(tc.ref, now, tc.retention))
+		})
+	}
+}
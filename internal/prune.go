@@ -0,0 +1,147 @@
+package gitfetcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mtth/gitfetcher/internal/fspath"
+)
+
+// orphanMarkerName is the name of the file, inside a gitdir, which records when the repository was
+// first found orphaned. It is removed when the repository is synced from a source again.
+const orphanMarkerName = "gitfetcher-orphaned-since"
+
+var errMissingQuarantineDir = errors.New("missing quarantine directory")
+
+// PruneAction is the action taken on orphaned repositories.
+type PruneAction int
+
+const (
+	// Only report orphaned repositories.
+	PruneActionList PruneAction = iota
+	// Move orphaned repositories to a quarantine directory.
+	PruneActionQuarantine
+	// Delete orphaned repositories.
+	PruneActionDelete
+)
+
+// PruneOptions configures Prune.
+type PruneOptions struct {
+	// Action taken on orphaned repositories whose grace period has expired.
+	Action PruneAction
+	// Root folder containing local repositories, used to preserve relative paths on quarantine.
+	Root fspath.Local
+	// Destination of quarantined repositories. Required for PruneActionQuarantine.
+	QuarantineDir fspath.Local
+	// Minimum duration since a repository was first found orphaned before it is quarantined or
+	// deleted.
+	GracePeriod time.Duration
+}
+
+// Orphan describes a local repository without any matching source.
+type Orphan struct {
+	// The repository's outermost directory, before any pruning.
+	RootDir fspath.Local
+	// Time at which the repository was first found orphaned.
+	Since time.Time
+	// True iff the repository was quarantined or deleted.
+	Pruned bool
+}
+
+// timeNow is swapped out for testing.
+var timeNow = time.Now
+
+// Prune finds orphaned syncables and, depending on the action, quarantines or deletes those whose
+// grace period has expired. The first time a repository is found orphaned, a marker is written in
+// its gitdir to start its grace period. Repositories already under the quarantine directory are
+// ignored.
+func Prune(syncables []Syncable, opts PruneOptions) ([]Orphan, error) {
+	if opts.Action == PruneActionQuarantine && opts.QuarantineDir == "" {
+		return nil, errMissingQuarantineDir
+	}
+
+	now := timeNow()
+	var orphans []Orphan
+	for _, syncable := range syncables {
+		rootDir := syncable.RootDir()
+		if syncable.SyncStatus() != SyncStatusOrphaned || isWithin(rootDir, opts.QuarantineDir) {
+			continue
+		}
+		since, err := orphanedSince(syncable.GitDir, now)
+		if err != nil {
+			return orphans, err
+		}
+		orphan := Orphan{RootDir: rootDir, Since: since}
+		if opts.Action != PruneActionList && now.Sub(since) >= opts.GracePeriod {
+			if err := pruneOrphan(rootDir, opts); err != nil {
+				return orphans, err
+			}
+			orphan.Pruned = true
+		}
+		orphans = append(orphans, orphan)
+	}
+	return orphans, nil
+}
+
+// orphanedSince returns the time recorded in the gitdir's orphan marker, writing one with the
+// current time if absent.
+func orphanedSince(gitDir fspath.Local, now time.Time) (time.Time, error) {
+	fp := filepath.Join(gitDir, orphanMarkerName)
+	data, err := os.ReadFile(fp)
+	if errors.Is(err, fs.ErrNotExist) {
+		return now, os.WriteFile(fp, []byte(now.UTC().Format(time.RFC3339)), 0644)
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	since, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid orphan marker %s: %w", fp, err)
+	}
+	return since, nil
+}
+
+func pruneOrphan(rootDir fspath.Local, opts PruneOptions) error {
+	switch opts.Action {
+	case PruneActionList:
+		return nil
+	case PruneActionDelete:
+		slog.Info("Deleting orphaned repository.", slog.String("path", rootDir))
+		return os.RemoveAll(rootDir)
+	case PruneActionQuarantine:
+		rel, err := filepath.Rel(opts.Root, rootDir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			rel = filepath.Base(rootDir)
+		}
+		dest := filepath.Join(opts.QuarantineDir, rel)
+		if fileExists(dest) {
+			// Avoid clobbering a previously quarantined copy.
+			dest += "." + timeNow().UTC().Format("20060102T150405Z")
+		}
+		slog.Info(
+			"Quarantining orphaned repository.",
+			slog.String("path", rootDir),
+			slog.String("dest", dest),
+		)
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		return os.Rename(rootDir, dest)
+	}
+	return nil
+}
+
+// isWithin returns true iff fp is dpath or one of its descendants. It returns false if dpath is
+// empty.
+func isWithin(fp, dpath fspath.Local) bool {
+	if dpath == "" {
+		return false
+	}
+	rel, err := filepath.Rel(dpath, fp)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,106 @@
+package gitfetcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/effect"
+	"github.com/mtth/gitfetcher/internal/source"
+	"github.com/mtth/gitfetcher/internal/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPruneFixture creates bare repositories under a temporary root and returns syncables where
+// only cool/kept has a source.
+func newPruneFixture(t *testing.T) (string, []Syncable) {
+	root := t.TempDir()
+	var targets []target.Target
+	for _, name := range []string{"cool/kept.git", "cool/gone.git"} {
+		gitDir := filepath.Join(root, name)
+		for _, dpath := range []string{"objects", "refs"} {
+			require.NoError(t, os.MkdirAll(filepath.Join(gitDir, dpath), 0755))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(gitDir, "HEAD"), nil, 0644))
+		tgt, err := target.FromPath(gitDir)
+		require.NoError(t, err)
+		targets = append(targets, tgt)
+	}
+	syncables, err := GatherSyncables(
+		targets,
+		[]source.Source{{FullName: "cool/kept", FetchURL: "http://example.com/kept"}},
+		root,
+		configpb.Options_BARE_LAYOUT,
+	)
+	require.NoError(t, err)
+	return root, syncables
+}
+
+func TestPrune(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("list marks orphans", func(t *testing.T) {
+		defer effect.Swap(&timeNow, func() time.Time { return t0 })()
+		root, syncables := newPruneFixture(t)
+		gone := filepath.Join(root, "cool/gone.git")
+
+		orphans, err := Prune(syncables, PruneOptions{Root: root})
+		require.NoError(t, err)
+		assert.Equal(t, []Orphan{{RootDir: gone, Since: t0}}, orphans)
+		assert.FileExists(t, filepath.Join(gone, orphanMarkerName))
+	})
+
+	t.Run("grace period", func(t *testing.T) {
+		root, syncables := newPruneFixture(t)
+		gone := filepath.Join(root, "cool/gone.git")
+		opts := PruneOptions{Action: PruneActionDelete, Root: root, GracePeriod: time.Hour}
+
+		restore := effect.Swap(&timeNow, func() time.Time { return t0 })
+		orphans, err := Prune(syncables, opts)
+		restore()
+		require.NoError(t, err)
+		require.Len(t, orphans, 1)
+		assert.False(t, orphans[0].Pruned)
+		assert.DirExists(t, gone)
+
+		defer effect.Swap(&timeNow, func() time.Time { return t0.Add(2 * time.Hour) })()
+		orphans, err = Prune(syncables, opts)
+		require.NoError(t, err)
+		assert.Equal(t, []Orphan{{RootDir: gone, Since: t0, Pruned: true}}, orphans)
+		assert.NoDirExists(t, gone)
+		assert.DirExists(t, filepath.Join(root, "cool/kept.git"))
+	})
+
+	t.Run("quarantine", func(t *testing.T) {
+		root, syncables := newPruneFixture(t)
+		quarantine := t.TempDir()
+
+		orphans, err := Prune(syncables, PruneOptions{
+			Action:        PruneActionQuarantine,
+			Root:          root,
+			QuarantineDir: quarantine,
+		})
+		require.NoError(t, err)
+		require.Len(t, orphans, 1)
+		assert.True(t, orphans[0].Pruned)
+		assert.NoDirExists(t, filepath.Join(root, "cool/gone.git"))
+		assert.FileExists(t, filepath.Join(quarantine, "cool/gone.git", orphanMarkerName))
+	})
+
+	t.Run("missing quarantine directory", func(t *testing.T) {
+		_, syncables := newPruneFixture(t)
+		_, err := Prune(syncables, PruneOptions{Action: PruneActionQuarantine})
+		assert.ErrorIs(t, err, errMissingQuarantineDir)
+	})
+}
+
+func TestIsWithin(t *testing.T) {
+	assert.True(t, isWithin("/a/b", "/a"))
+	assert.True(t, isWithin("/a", "/a"))
+	assert.False(t, isWithin("/ab", "/a"))
+	assert.False(t, isWithin("/a", "/a/b"))
+	assert.False(t, isWithin("/a", ""))
+}
@@ -0,0 +1,54 @@
+package gitfetcher
+
+import (
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/mtth/gitfetcher/internal/except"
+	"github.com/mtth/gitfetcher/internal/fspath"
+	"github.com/mtth/gitfetcher/internal/target"
+)
+
+// sourceIDConfigKey is the git configuration key storing the stable ID of a target's source.
+const sourceIDConfigKey = "gitfetcher.sourceId"
+
+// readSourceID returns the source ID recorded in a gitdir, or an empty string if absent.
+func readSourceID(gitDir fspath.Local) string {
+	cfg, err := target.ReadConfig(gitDir)
+	if err != nil {
+		slog.Warn("Unable to read target config.", except.LogErrAttr(err), slog.String("path", gitDir))
+		return ""
+	}
+	return cfg.Get(sourceIDConfigKey)
+}
+
+// canRelocate returns true iff the target can be moved to the gitdir while preserving its layout,
+// and its remote is on the same host as the new fetch URL.
+func canRelocate(tgt target.Target, gitDir fspath.Local, fetchURL string) bool {
+	if target.IsBare(tgt) == (filepath.Base(gitDir) == target.GitDirName) {
+		return false
+	}
+	cfg, err := target.ReadConfig(tgt.GitDir())
+	if err != nil {
+		slog.Warn("Unable to read target config.", except.LogErrAttr(err))
+		return false
+	}
+	return remoteHost(cfg.Get("remote."+target.DefaultRemote+".url")) == remoteHost(fetchURL)
+}
+
+// remoteHost returns the hostname of a git remote URL, including scp-like SSH ones (for example
+// git@github.com:ann/one.git). It returns an empty string if the URL has no host.
+func remoteHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Hostname()
+	}
+	if _, rest, ok := strings.Cut(rawURL, "@"); ok {
+		rawURL = rest
+	}
+	if host, _, ok := strings.Cut(rawURL, ":"); ok && !strings.Contains(host, "/") {
+		return host
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+// Package retry implements retries with jittered exponential backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/except"
+)
+
+// Defaults used for unset configuration values.
+const (
+	defaultMaxAttempts  = 3
+	defaultInitialDelay = time.Second
+	defaultMaxDelay     = time.Minute
+)
+
+// Policy configures retries. Its zero value disables them.
+type Policy struct {
+	// Maximum number of attempts, including the first one.
+	MaxAttempts int
+	// Delay before the first retry. Each subsequent delay doubles.
+	InitialDelay time.Duration
+	// Maximum delay between attempts, ignored if zero.
+	MaxDelay time.Duration
+}
+
+// NewPolicy returns the policy matching the configuration, which may be nil.
+func NewPolicy(cfg *configpb.RetryOptions) Policy {
+	policy := Policy{
+		MaxAttempts:  defaultMaxAttempts,
+		InitialDelay: defaultInitialDelay,
+		MaxDelay:     defaultMaxDelay,
+	}
+	if n := cfg.GetMaxAttempts(); n > 0 {
+		policy.MaxAttempts = int(n)
+	}
+	if d := cfg.GetInitialDelay(); d != nil {
+		policy.InitialDelay = d.AsDuration()
+	}
+	if d := cfg.GetMaxDelay(); d != nil {
+		policy.MaxDelay = d.AsDuration()
+	}
+	return policy
+}
+
+// Do calls fn until it succeeds, fails with an error rejected by retryable, the maximum number of
+// attempts is reached, or the context is done. The last error is returned.
+func (p Policy) Do(ctx context.Context, fn func() error, retryable func(error) bool) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !retryable(err) {
+			return err
+		}
+		if p.wait(ctx, attempt, err) != nil {
+			return err
+		}
+	}
+}
+
+// wait sleeps before the next attempt, returning early with an error if the context is done.
+func (p Policy) wait(ctx context.Context, attempt int, cause error) error {
+	delay := p.delay(attempt)
+	slog.Debug(
+		"Retrying after transient failure.",
+		except.LogErrAttr(cause),
+		slog.Int("attempt", attempt),
+		slog.Duration("delay", delay),
+	)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// delay returns a randomized delay in [d/2, d], where d grows exponentially with the attempt.
+func (p Policy) delay(attempt int) time.Duration {
+	d := p.InitialDelay << (attempt - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1) //nolint:gosec
+}
+
+// Transport is an http.RoundTripper which retries idempotent requests which fail transiently.
+type Transport struct {
+	// Underlying transport, defaults to http.DefaultTransport.
+	Base   http.RoundTripper
+	Policy Policy
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return base.RoundTrip(req)
+	}
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		res, err := base.RoundTrip(req)
+		if attempt >= t.Policy.MaxAttempts || ctx.Err() != nil {
+			return res, err
+		}
+		var cause error
+		switch {
+		case err != nil:
+			if !IsTransientNetworkError(err) {
+				return nil, err
+			}
+			cause = err
+		case IsTransientStatus(res.StatusCode):
+			cause = errors.New(res.Status) //nolint:err113
+			_, _ = io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		default:
+			return res, nil
+		}
+		if err := t.Policy.wait(ctx, attempt, cause); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// IsTransientStatus returns true iff the HTTP status code is worth retrying.
+func IsTransientStatus(code int) bool {
+	switch code {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsTransientNetworkError returns true iff the error is a network failure worth retrying, for
+// example a timeout or a reset connection.
+func IsTransientNetworkError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout() ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
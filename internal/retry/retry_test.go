@@ -0,0 +1,173 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+var errTransient = errors.New("transient")
+
+func isTransient(err error) bool { return errors.Is(err, errTransient) }
+
+func TestNewPolicy(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		assert.Equal(t, Policy{
+			MaxAttempts:  3,
+			InitialDelay: time.Second,
+			MaxDelay:     time.Minute,
+		}, NewPolicy(nil))
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		assert.Equal(t, Policy{
+			MaxAttempts:  1,
+			InitialDelay: 5 * time.Second,
+			MaxDelay:     time.Minute,
+		}, NewPolicy(&configpb.RetryOptions{
+			MaxAttempts:  1,
+			InitialDelay: durationpb.New(5 * time.Second),
+		}))
+	})
+}
+
+func TestPolicy_Do(t *testing.T) {
+	ctx := context.Background()
+	policy := Policy{MaxAttempts: 3, InitialDelay: time.Millisecond}
+
+	t.Run("eventual success", func(t *testing.T) {
+		var attempts int
+		err := policy.Do(ctx, func() error {
+			attempts++
+			if attempts < 3 {
+				return errTransient
+			}
+			return nil
+		}, isTransient)
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		var attempts int
+		err := policy.Do(ctx, func() error {
+			attempts++
+			return errTransient
+		}, isTransient)
+		assert.ErrorIs(t, err, errTransient)
+		assert.Equal(t, 3, attempts)
+	})
+
+	t.Run("fatal error", func(t *testing.T) {
+		errFatal := errors.New("fatal") //nolint:err113
+		var attempts int
+		err := policy.Do(ctx, func() error {
+			attempts++
+			return errFatal
+		}, isTransient)
+		assert.ErrorIs(t, err, errFatal)
+		assert.Equal(t, 1, attempts)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		var attempts int
+		err := Policy{MaxAttempts: 3, InitialDelay: time.Hour}.Do(ctx, func() error {
+			attempts++
+			return errTransient
+		}, isTransient)
+		assert.ErrorIs(t, err, errTransient)
+		assert.Equal(t, 1, attempts)
+	})
+}
+
+func TestPolicy_delay(t *testing.T) {
+	policy := Policy{InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+	for attempt, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		3:  4 * time.Second,
+		4:  5 * time.Second,
+		80: 5 * time.Second,
+	} {
+		for range 10 {
+			got := policy.delay(attempt)
+			assert.GreaterOrEqual(t, got, want/2)
+			assert.LessOrEqual(t, got, want)
+		}
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if strings.HasSuffix(r.URL.Path, "/flaky") && attempts < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/down") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/missing") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{
+		Policy: Policy{MaxAttempts: 3, InitialDelay: time.Millisecond},
+	}}
+
+	for key, tc := range map[string]struct {
+		method   string
+		path     string
+		code     int
+		attempts int
+	}{
+		"transient failure": {http.MethodGet, "/flaky", http.StatusOK, 3},
+		"attempts exhausted": {
+			http.MethodGet, "/down", http.StatusServiceUnavailable, 3,
+		},
+		"fatal status":   {http.MethodGet, "/missing", http.StatusNotFound, 1},
+		"non-idempotent": {http.MethodPost, "/down", http.StatusServiceUnavailable, 1},
+	} {
+		t.Run(key, func(t *testing.T) {
+			attempts = 0
+			req, err := http.NewRequestWithContext(
+				context.Background(), tc.method, server.URL+tc.path, nil,
+			)
+			require.NoError(t, err)
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			defer res.Body.Close()
+			assert.Equal(t, tc.code, res.StatusCode)
+			assert.Equal(t, tc.attempts, attempts)
+		})
+	}
+}
+
+func TestIsTransientNetworkError(t *testing.T) {
+	assert.False(t, IsTransientNetworkError(errTransient))
+	assert.False(t, IsTransientNetworkError(context.DeadlineExceeded))
+	assert.True(t, IsTransientNetworkError(&timeoutError{}))
+}
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string   { return "timeout" }
+func (e *timeoutError) Timeout() bool   { return true }
+func (e *timeoutError) Temporary() bool { return true }
@@ -0,0 +1,276 @@
+package source
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+const defaultBitbucketCloudURL = "https://api.bitbucket.org/2.0"
+
+// bitbucketLink is a named link, used in particular for clone URLs.
+type bitbucketLink struct {
+	Name string `json:"name"`
+	Href string `json:"href"`
+}
+
+// bitbucketCloneURL returns the clone URL with the first matching name, or an empty string.
+func bitbucketCloneURL(links []bitbucketLink, names ...string) string {
+	for _, name := range names {
+		for _, link := range links {
+			if link.Name == name {
+				return link.Href
+			}
+		}
+	}
+	return ""
+}
+
+// bitbucketCloudRepo contains the subset of Bitbucket Cloud's repository representation used to
+// create sources. See https://developer.atlassian.com/cloud/bitbucket/rest/api-group-repositories.
+type bitbucketCloudRepo struct {
+	Slug        string    `json:"slug"`
+	FullName    string    `json:"full_name"`
+	Description string    `json:"description"`
+	UpdatedOn   time.Time `json:"updated_on"`
+	MainBranch  *struct {
+		Name string `json:"name"`
+	} `json:"mainbranch"`
+	Parent *struct{} `json:"parent"`
+	Links  struct {
+		Clone []bitbucketLink `json:"clone"`
+	} `json:"links"`
+}
+
+type bitbucketCloudPage struct {
+	Values []bitbucketCloudRepo `json:"values"`
+	Next   string               `json:"next"`
+}
+
+func (c *sourceGatherer) gatherBitbucketCloudSources(
+	ctx context.Context,
+	cfg *configpb.BitbucketCloudSource,
+) error {
+	var flags []string
+	header := make(http.Header)
+	if token := expandToken(cfg.GetAccessToken()); token != "" {
+		flags = credentialFlags("x-token-auth", token)
+		header.Set("Authorization", "Bearer "+token)
+	} else if username := cfg.GetUsername(); username != "" {
+		password := expandToken(cfg.GetAppPassword())
+		flags = credentialFlags(username, password)
+		creds := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		header.Set("Authorization", "Basic "+creds)
+	}
+
+	pred, err := newNamePredicate(cfg.GetFilters())
+	if err != nil {
+		return err
+	}
+
+	baseURL := strings.TrimSuffix(cmp.Or(cfg.GetApiUrl(), defaultBitbucketCloudURL), "/")
+	next := baseURL + "/repositories/" + url.PathEscape(cfg.GetWorkspace()) + "?pagelen=50"
+	var added, skipped int
+	for next != "" {
+		var page bitbucketCloudPage
+		if _, err := getJSON(ctx, c.httpClient, next, header, &page); err != nil {
+			return fmt.Errorf("%w: %w", errBitbucketListFailed, err)
+		}
+		for _, repo := range page.Values {
+			if (repo.Parent != nil && !cfg.GetIncludeForks()) || !pred.accept(repo.FullName) {
+				skipped++
+				continue
+			}
+
+			path, err := templateSourcePath(
+				cfg.GetPathTemplate(),
+				repo.FullName,
+				repo.Slug,
+				cfg.GetWorkspace(),
+			)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidPath, err)
+			}
+
+			c.builder.addBitbucketCloudRepo(&repo, sourceOptions{
+				fetchFlags:     flags,
+				remoteProtocol: cfg.GetRemoteProtocol(),
+				path:           path,
+			})
+			added++
+		}
+		next = page.Next
+	}
+	slog.Debug("Added Bitbucket source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+func (b *sourcesBuilder) addBitbucketCloudRepo(repo *bitbucketCloudRepo, opts sourceOptions) {
+	src := Source{
+		FullName:      repo.FullName,
+		Description:   repo.Description,
+		DefaultBranch: opts.defaultBranch,
+		LastUpdatedAt: repo.UpdatedOn,
+		RelPath:       opts.path,
+		FetchFlags:    opts.fetchFlags,
+	}
+	if src.DefaultBranch == "" && repo.MainBranch != nil {
+		src.DefaultBranch = repo.MainBranch.Name
+	}
+	switch opts.remoteProtocol {
+	case configpb.RemoteProtocol_DEFAULT_REMOTE_PROTOCOL:
+		src.FetchURL = bitbucketCloneURL(repo.Links.Clone, "https")
+	case configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL:
+		src.FetchURL = bitbucketCloneURL(repo.Links.Clone, "ssh")
+	}
+	*b = append(*b, src)
+}
+
+// bitbucketServerRepo contains the subset of Bitbucket Data Center's repository representation used
+// to create sources. See https://developer.atlassian.com/server/bitbucket/rest.
+type bitbucketServerRepo struct {
+	Slug        string    `json:"slug"`
+	Description string    `json:"description"`
+	Archived    bool      `json:"archived"`
+	Origin      *struct{} `json:"origin"`
+	Project     struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Clone []bitbucketLink `json:"clone"`
+	} `json:"links"`
+
+	// Populated via separate requests.
+	defaultBranch string
+}
+
+func (r *bitbucketServerRepo) fullName() string {
+	return r.Project.Key + "/" + r.Slug
+}
+
+type bitbucketServerPage struct {
+	Values        []bitbucketServerRepo `json:"values"`
+	IsLastPage    bool                  `json:"isLastPage"`
+	NextPageStart int                   `json:"nextPageStart"`
+}
+
+func (c *sourceGatherer) gatherBitbucketServerSources(
+	ctx context.Context,
+	cfg *configpb.BitbucketServerSource,
+) error {
+	baseURL, err := url.Parse(strings.TrimSuffix(cfg.GetBaseUrl(), "/"))
+	if err != nil || baseURL.Host == "" {
+		return fmt.Errorf("%w: %s", errInvalidURL, cfg.GetBaseUrl())
+	}
+	reposURL := baseURL.JoinPath("rest/api/1.0/projects", cfg.GetProject(), "repos")
+
+	var flags []string
+	header := make(http.Header)
+	if token := expandToken(cfg.GetToken()); token != "" {
+		flags = bearerFlags(token)
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	filter, err := newRepoFilter(cfg)
+	if err != nil {
+		return err
+	}
+
+	var added, skipped int
+	for start, isLastPage := 0, false; !isLastPage; {
+		query := url.Values{"start": {strconv.Itoa(start)}, "limit": {"50"}}
+		pageURL := reposURL.String() + "?" + query.Encode()
+		var page bitbucketServerPage
+		if _, err := getJSON(ctx, c.httpClient, pageURL, header, &page); err != nil {
+			return fmt.Errorf("%w: %w", errBitbucketListFailed, err)
+		}
+		for _, repo := range page.Values {
+			if !filter.accept(repo.fullName(), repo.Origin != nil, repo.Archived) {
+				skipped++
+				continue
+			}
+
+			path, err := templateSourcePath(
+				cfg.GetPathTemplate(),
+				repo.fullName(),
+				repo.Slug,
+				repo.Project.Key,
+			)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidPath, err)
+			}
+
+			repoURL := reposURL.JoinPath(repo.Slug)
+			if err := c.populateBitbucketServerRepo(ctx, repoURL, header, &repo); err != nil {
+				return fmt.Errorf("%w: %w", errBitbucketListFailed, err)
+			}
+
+			c.builder.addBitbucketServerRepo(&repo, sourceOptions{
+				fetchFlags:     flags,
+				remoteProtocol: cfg.GetRemoteProtocol(),
+				path:           path,
+			})
+			added++
+		}
+		start, isLastPage = page.NextPageStart, page.IsLastPage
+	}
+	slog.Debug("Added Bitbucket source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+// populateBitbucketServerRepo fetches the repository's default branch, which is not included in
+// listings. It is left empty for empty repositories.
+func (c *sourceGatherer) populateBitbucketServerRepo(
+	ctx context.Context,
+	repoURL *url.URL,
+	header http.Header,
+	repo *bitbucketServerRepo,
+) error {
+	var branch struct {
+		DisplayID string `json:"displayId"`
+	}
+	branchURL := repoURL.JoinPath("default-branch").String()
+	if _, err := getJSON(ctx, c.httpClient, branchURL, header, &branch); err != nil {
+		return ignoreNotFound(err)
+	}
+	repo.defaultBranch = branch.DisplayID
+	return nil
+}
+
+func (b *sourcesBuilder) addBitbucketServerRepo(repo *bitbucketServerRepo, opts sourceOptions) {
+	// Data Center doesn't expose when repositories were last pushed to. Commit times aren't a
+	// substitute since they ignore other branches, so LastUpdatedAt is left unset to always fetch.
+	src := Source{
+		FullName:      repo.fullName(),
+		Description:   repo.Description,
+		DefaultBranch: cmp.Or(opts.defaultBranch, repo.defaultBranch),
+		RelPath:       opts.path,
+		FetchFlags:    opts.fetchFlags,
+	}
+	switch opts.remoteProtocol {
+	case configpb.RemoteProtocol_DEFAULT_REMOTE_PROTOCOL:
+		src.FetchURL = bitbucketCloneURL(repo.Links.Clone, "http", "https")
+	case configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL:
+		src.FetchURL = bitbucketCloneURL(repo.Links.Clone, "ssh")
+	}
+	*b = append(*b, src)
+}
+
+// ignoreNotFound returns nil if err was caused by a 404 response, and err otherwise.
+func ignoreNotFound(err error) error {
+	var serr *statusError
+	if errors.As(err, &serr) && serr.code == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSources_BitbucketCloud(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	repo := func(slug string) map[string]any {
+		return map[string]any{
+			"slug":        slug,
+			"full_name":   "acme/" + slug,
+			"description": "About " + slug,
+			"updated_on":  t0.Format(time.RFC3339),
+			"mainbranch":  map[string]any{"name": "develop"},
+			"links": map[string]any{"clone": []map[string]any{
+				{"name": "https", "href": "https://bitbucket.org/acme/" + slug + ".git"},
+				{"name": "ssh", "href": "git@bitbucket.org:acme/" + slug + ".git"},
+			}},
+		}
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "ann" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var page map[string]any
+		switch r.URL.Path {
+		case "/repositories/acme":
+			fork := repo("fork")
+			fork["parent"] = map[string]any{"full_name": "other/fork"}
+			page = map[string]any{
+				"values": []map[string]any{repo("one"), fork},
+				"next":   server.URL + "/page2",
+			}
+		case "/page2":
+			page = map[string]any{"values": []map[string]any{repo("two")}}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	t.Run("app password", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromBitbucketCloud{
+				FromBitbucketCloud: &configpb.BitbucketCloudSource{
+					Workspace:   "acme",
+					Username:    "ann",
+					AppPassword: "secret",
+					ApiUrl:      server.URL,
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "acme/one", srcs[0].FullName)
+		assert.Equal(t, "About one", srcs[0].Description)
+		assert.Equal(t, "develop", srcs[0].DefaultBranch)
+		assert.True(t, t0.Equal(srcs[0].LastUpdatedAt))
+		assert.Equal(t, "https://bitbucket.org/acme/one.git", srcs[0].FetchURL)
+		assert.Contains(t, srcs[0].FetchFlags[1], "username=ann")
+		assert.Equal(t, "acme/two", srcs[1].FullName)
+	})
+
+	t.Run("forks over SSH", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromBitbucketCloud{
+				FromBitbucketCloud: &configpb.BitbucketCloudSource{
+					Workspace:      "acme",
+					Username:       "ann",
+					AppPassword:    "secret",
+					ApiUrl:         server.URL,
+					IncludeForks:   true,
+					Filters:        []string{"acme/f*"},
+					RemoteProtocol: configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL,
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "git@bitbucket.org:acme/fork.git", srcs[0].FetchURL)
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromBitbucketCloud{
+				FromBitbucketCloud: &configpb.BitbucketCloudSource{
+					Workspace:   "acme",
+					AccessToken: "abc",
+					ApiUrl:      server.URL,
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errBitbucketListFailed)
+	})
+}
+
+func TestLoadSources_BitbucketServer(t *testing.T) {
+	ctx := context.Background()
+
+	repo := func(slug string) map[string]any {
+		return map[string]any{
+			"slug":    slug,
+			"project": map[string]any{"key": "PRJ"},
+			"links": map[string]any{"clone": []map[string]any{
+				{"name": "ssh", "href": "ssh://git@bitbucket.example.com:7999/prj/" + slug + ".git"},
+				{"name": "http", "href": "https://bitbucket.example.com/scm/prj/" + slug + ".git"},
+			}},
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/api/1.0/projects/PRJ/repos", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var page map[string]any
+		switch r.URL.Query().Get("start") {
+		case "0":
+			archived := repo("old")
+			archived["archived"] = true
+			page = map[string]any{
+				"values":        []map[string]any{repo("one"), archived},
+				"nextPageStart": 2,
+			}
+		case "2":
+			page = map[string]any{"values": []map[string]any{repo("empty")}, "isLastPage": true}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	})
+	repoPath := "/rest/api/1.0/projects/PRJ/repos/one"
+	mux.HandleFunc(repoPath+"/default-branch", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"displayId": "main"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("project", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromBitbucketServer{
+				FromBitbucketServer: &configpb.BitbucketServerSource{
+					BaseUrl:      server.URL,
+					Project:      "PRJ",
+					Token:        "secret",
+					PathTemplate: "bitbucket/{{ .FullName }}",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, Source{
+			FullName:      "PRJ/one",
+			DefaultBranch: "main",
+			RelPath:       "bitbucket/PRJ/one",
+			FetchURL:      "https://bitbucket.example.com/scm/prj/one.git",
+			FetchFlags:    bearerFlags("secret"),
+		}, srcs[0])
+		assert.Equal(t, "PRJ/empty", srcs[1].FullName)
+		assert.Empty(t, srcs[1].DefaultBranch)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromBitbucketServer{
+				FromBitbucketServer: &configpb.BitbucketServerSource{
+					BaseUrl: server.URL,
+					Project: "PRJ",
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errBitbucketListFailed)
+	})
+}
@@ -0,0 +1,111 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+// commandRepo is the representation of a repository printed by source commands.
+type commandRepo struct {
+	URL           string    `json:"url"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	DefaultBranch string    `json:"default_branch"`
+	LastUpdatedAt time.Time `json:"last_updated_at"`
+	Path          string    `json:"path"`
+}
+
+func (c *sourceGatherer) gatherCommandSources(
+	ctx context.Context,
+	cfg *configpb.CommandSource,
+) error {
+	args := cfg.GetCommand()
+	if len(args) == 0 {
+		return fmt.Errorf("%w: empty command", errCommandFailed)
+	}
+
+	pred, err := newNamePredicate(cfg.GetFilters())
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("%w: %v: %v", errCommandFailed, err, strings.TrimSpace(stderr.String()))
+	}
+	repos, err := parseCommandRepos(out)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidCommandOutput, err)
+	}
+
+	var added, skipped int
+	for _, repo := range repos {
+		if repo.URL == "" {
+			return fmt.Errorf("%w: %q", errInvalidURL, repo.URL)
+		}
+		fullName := repo.FullName
+		if fullName == "" {
+			repoURL, err := parseRemoteURL(repo.URL)
+			if err != nil {
+				return fmt.Errorf("%w: %q", errInvalidURL, repo.URL)
+			}
+			fullName = fullNameFromURL(repoURL)
+		}
+		if !pred.accept(fullName) {
+			skipped++
+			continue
+		}
+		c.builder.addCommandRepo(&repo, fullName)
+		added++
+	}
+	slog.Debug("Added command source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+// parseCommandRepos decodes either a JSON array of repositories or a stream of repositories.
+func parseCommandRepos(data []byte) ([]commandRepo, error) {
+	var repos []commandRepo
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		if err := json.Unmarshal(trimmed, &repos); err != nil {
+			return nil, err
+		}
+		return repos, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		var repo commandRepo
+		err := decoder.Decode(&repo)
+		if errors.Is(err, io.EOF) {
+			return repos, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		repos = append(repos, repo)
+	}
+}
+
+func (b *sourcesBuilder) addCommandRepo(repo *commandRepo, fullName string) {
+	*b = append(*b, Source{
+		FullName:      fullName,
+		Description:   repo.Description,
+		DefaultBranch: repo.DefaultBranch,
+		LastUpdatedAt: repo.LastUpdatedAt,
+		RelPath:       repo.Path,
+		FetchURL:      repo.URL,
+	})
+}
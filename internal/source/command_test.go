@@ -0,0 +1,120 @@
+package source
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSources_Command(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("JSON array", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{
+					Command: []string{"echo", `[
+						{
+							"url": "https://git.example.com/team/one.git",
+							"description": "First",
+							"default_branch": "trunk",
+							"last_updated_at": "2024-05-01T12:00:00Z",
+							"path": "mirrors/one"
+						},
+						{"url": "https://git.example.com/other/two.git", "full_name": "two"}
+					]`},
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, Source{
+			FullName:      "team/one",
+			Description:   "First",
+			DefaultBranch: "trunk",
+			LastUpdatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			RelPath:       "mirrors/one",
+			FetchURL:      "https://git.example.com/team/one.git",
+		}, srcs[0])
+		assert.Equal(t, "two", srcs[1].FullName)
+	})
+
+	t.Run("JSON lines with filters", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{
+					Command: []string{"printf", "%s\n%s\n",
+						`{"url": "https://git.example.com/team/one.git"}`,
+						`{"url": "https://git.example.com/other/two.git"}`,
+					},
+					Filters: []string{"other/*"},
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "other/two", srcs[0].FullName)
+	})
+
+	t.Run("SSH URLs", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{
+					Command: []string{"printf", "%s\n%s\n",
+						`{"url": "git@git.internal:team/one.git"}`,
+						`{"url": "git@git.internal:team/two.git", "full_name": "two"}`,
+					},
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "team/one", srcs[0].FullName)
+		assert.Equal(t, "git@git.internal:team/one.git", srcs[0].FetchURL)
+		assert.Equal(t, "two", srcs[1].FullName)
+	})
+
+	t.Run("empty output", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{Command: []string{"true"}},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		assert.Empty(t, srcs)
+	})
+
+	t.Run("failed command", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{Command: []string{"false"}},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errCommandFailed)
+	})
+
+	t.Run("invalid output", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{Command: []string{"echo", "{"}},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidCommandOutput)
+	})
+
+	t.Run("missing URL", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromCommand{
+				FromCommand: &configpb.CommandSource{Command: []string{"echo", `{"full_name": "a/b"}`}},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidURL)
+	})
+}
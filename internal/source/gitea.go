@@ -0,0 +1,122 @@
+package source
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+// giteaRepo contains the subset of Gitea's repository representation used to create sources. The
+// same API is exposed by Forgejo. See https://docs.gitea.com/api.
+type giteaRepo struct {
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	DefaultBranch string    `json:"default_branch"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	CloneURL      string    `json:"clone_url"`
+	SSHURL        string    `json:"ssh_url"`
+	Fork          bool      `json:"fork"`
+	Archived      bool      `json:"archived"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+func (c *sourceGatherer) gatherGiteaSources(
+	ctx context.Context,
+	cfg *configpb.GiteaSource,
+) error {
+	baseURL, err := url.Parse(strings.TrimSuffix(cfg.GetBaseUrl(), "/"))
+	if err != nil || baseURL.Host == "" {
+		return fmt.Errorf("%w: %s", errInvalidURL, cfg.GetBaseUrl())
+	}
+
+	var flags []string
+	header := make(http.Header)
+	if token := expandToken(cfg.GetToken()); token != "" {
+		// Gitea treats the username as a token when the password is set to this placeholder.
+		flags = credentialFlags(token, "x-oauth-basic")
+		header.Set("Authorization", "token "+token)
+	}
+
+	var endpoint string
+	switch owner := cfg.GetOwner().(type) {
+	case *configpb.GiteaSource_Organization:
+		endpoint = "/api/v1/orgs/" + url.PathEscape(owner.Organization) + "/repos"
+	case *configpb.GiteaSource_User:
+		endpoint = "/api/v1/users/" + url.PathEscape(owner.User) + "/repos"
+	default:
+		endpoint = "/api/v1/user/repos"
+	}
+
+	filter, err := newRepoFilter(cfg)
+	if err != nil {
+		return err
+	}
+
+	var added, skipped int
+	for page := 1; ; page++ {
+		query := url.Values{"page": {strconv.Itoa(page)}, "limit": {"50"}}
+		pageURL := baseURL.JoinPath(endpoint).String() + "?" + query.Encode()
+		var repos []giteaRepo
+		if _, err := getJSON(ctx, c.httpClient, pageURL, header, &repos); err != nil {
+			return fmt.Errorf("%w: %w", errGiteaRequestFailed, err)
+		}
+		if len(repos) == 0 {
+			// Instances may cap the page size, so we only stop once we get an empty page.
+			break
+		}
+		for _, repo := range repos {
+			if !filter.accept(repo.FullName, repo.Fork, repo.Archived) {
+				skipped++
+				continue
+			}
+
+			path, err := templateSourcePath(
+				cfg.GetPathTemplate(),
+				repo.FullName,
+				repo.Name,
+				repo.Owner.Login,
+			)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidPath, err)
+			}
+
+			c.builder.addGiteaRepo(&repo, sourceOptions{
+				fetchFlags:     flags,
+				remoteProtocol: cfg.GetRemoteProtocol(),
+				path:           path,
+			})
+			added++
+		}
+	}
+	slog.Debug("Added Gitea source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+func (b *sourcesBuilder) addGiteaRepo(repo *giteaRepo, opts sourceOptions) {
+	src := Source{
+		FullName:      repo.FullName,
+		Description:   repo.Description,
+		DefaultBranch: cmp.Or(opts.defaultBranch, repo.DefaultBranch),
+		LastUpdatedAt: repo.UpdatedAt,
+		RelPath:       opts.path,
+		FetchFlags:    opts.fetchFlags,
+	}
+	switch opts.remoteProtocol {
+	case configpb.RemoteProtocol_DEFAULT_REMOTE_PROTOCOL:
+		src.FetchURL = repo.CloneURL
+	case configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL:
+		src.FetchURL = repo.SSHURL
+	}
+	*b = append(*b, src)
+}
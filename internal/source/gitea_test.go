@@ -0,0 +1,123 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSources_Gitea(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	repo := func(owner, name string) map[string]any {
+		return map[string]any{
+			"name":           name,
+			"full_name":      owner + "/" + name,
+			"description":    "About " + name,
+			"default_branch": "main",
+			"updated_at":     t0.Format(time.RFC3339),
+			"clone_url":      "https://forge.example.com/" + owner + "/" + name + ".git",
+			"ssh_url":        "git@forge.example.com:" + owner + "/" + name + ".git",
+			"owner":          map[string]any{"login": owner},
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/user/repos", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var repos []map[string]any
+		if r.URL.Query().Get("page") == "1" {
+			fork := repo("ann", "fork")
+			fork["fork"] = true
+			repos = append(repos, repo("ann", "private"), fork)
+		}
+		_ = json.NewEncoder(w).Encode(repos)
+	})
+	mux.HandleFunc("/api/v1/orgs/acme/repos", func(w http.ResponseWriter, r *http.Request) {
+		var repos []map[string]any
+		switch r.URL.Query().Get("page") {
+		case "1":
+			archived := repo("acme", "old")
+			archived["archived"] = true
+			repos = append(repos, repo("acme", "one"), archived)
+		case "2":
+			repos = append(repos, repo("acme", "two"))
+		}
+		_ = json.NewEncoder(w).Encode(repos)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGitea{
+				FromGitea: &configpb.GiteaSource{
+					BaseUrl: server.URL,
+					Token:   "secret",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "ann/private", srcs[0].FullName)
+		assert.Equal(t, "About private", srcs[0].Description)
+		assert.Equal(t, "main", srcs[0].DefaultBranch)
+		assert.True(t, t0.Equal(srcs[0].LastUpdatedAt))
+		assert.Equal(t, "https://forge.example.com/ann/private.git", srcs[0].FetchURL)
+		assert.NotEmpty(t, srcs[0].FetchFlags)
+	})
+
+	t.Run("organization", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGitea{
+				FromGitea: &configpb.GiteaSource{
+					BaseUrl:         server.URL,
+					Owner:           &configpb.GiteaSource_Organization{Organization: "acme"},
+					IncludeArchived: true,
+					RemoteProtocol:  configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL,
+					PathTemplate:    "gitea/{{ .Name }}",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 3)
+		assert.Equal(t, []string{"acme/one", "acme/old", "acme/two"}, []string{
+			srcs[0].FullName, srcs[1].FullName, srcs[2].FullName,
+		})
+		assert.Equal(t, "gitea/two", srcs[2].RelPath)
+		assert.Equal(t, "git@forge.example.com:acme/two.git", srcs[2].FetchURL)
+		assert.Empty(t, srcs[2].FetchFlags)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGitea{
+				FromGitea: &configpb.GiteaSource{
+					BaseUrl: server.URL,
+					Token:   "abc",
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errGiteaRequestFailed)
+	})
+
+	t.Run("invalid base URL", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGitea{FromGitea: &configpb.GiteaSource{}},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidURL)
+	})
+}
@@ -0,0 +1,227 @@
+package source
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/go-github/v66/github"
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+// githubReposConfig is implemented by configurations which add all repositories from a GitHub
+// listing.
+type githubReposConfig interface {
+	repoFilterConfig
+	GetRemoteProtocol() configpb.RemoteProtocol
+	GetPathTemplate() string
+}
+
+// githubPageLister returns a single page of GitHub repositories.
+type githubPageLister func(opts github.ListOptions) ([]*github.Repository, *github.Response, error)
+
+// githubClientFor returns a client targeting the given API base URL, or github.com if empty.
+func (c *sourceGatherer) githubClientFor(apiURL string) (*github.Client, error) {
+	if apiURL == "" {
+		return c.githubClient, nil
+	}
+	client, err := c.githubClient.WithEnterpriseURLs(apiURL, apiURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidURL, apiURL)
+	}
+	return client, nil
+}
+
+// githubAuthConfig is implemented by configurations which authenticate to GitHub.
+type githubAuthConfig interface {
+	GetApiUrl() string
+	GetToken() string
+}
+
+// githubAppAuthConfig is implemented by configurations which support GitHub App authentication.
+type githubAppAuthConfig interface {
+	GetAppAuth() *configpb.GithubAppAuth
+}
+
+// githubAuth returns a client and source options authenticated with the configuration's GitHub App
+// credentials if present, and its (possibly expanded) token otherwise. If neither is set, the
+// client is unauthenticated and the options are empty.
+func (c *sourceGatherer) githubAuth(cfg githubAuthConfig) (*github.Client, sourceOptions, error) {
+	var opts sourceOptions
+	client, err := c.githubClientFor(cfg.GetApiUrl())
+	if err != nil {
+		return nil, opts, err
+	}
+	if appCfg, ok := cfg.(githubAppAuthConfig); ok && appCfg.GetAppAuth() != nil {
+		tokens, err := newGithubAppTokens(client, appCfg.GetAppAuth())
+		if err != nil {
+			return nil, opts, err
+		}
+		authed := github.NewClient(&http.Client{Transport: tokens})
+		authed.BaseURL, authed.UploadURL = client.BaseURL, client.UploadURL
+		opts.fetchCredentials = tokens.fetchFlags
+		return authed, opts, nil
+	}
+	token := expandToken(cfg.GetToken())
+	if token == "" {
+		return client, opts, nil
+	}
+	opts.fetchFlags = credentialFlags("token", token)
+	return client.WithAuthToken(token), opts, nil
+}
+
+// addGithubRepos adds all repositories returned by list which are accepted by the configuration's
+// filters, following pagination until the last page.
+func (c *sourceGatherer) addGithubRepos(
+	cfg githubReposConfig,
+	srcOpts sourceOptions,
+	list githubPageLister,
+) error {
+	filter, err := newRepoFilter(cfg)
+	if err != nil {
+		return err
+	}
+
+	opts := github.ListOptions{PerPage: 50}
+	var added, skipped int
+	for {
+		repos, res, err := list(opts)
+		if err != nil {
+			return err
+		}
+		for _, repo := range repos {
+			if !filter.accept(repo.GetFullName(), repo.GetFork(), repo.GetArchived()) {
+				skipped++
+				continue
+			}
+
+			path, err := githubSourcePath(cfg.GetPathTemplate(), repo)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidPath, err)
+			}
+
+			srcOpts.remoteProtocol = cfg.GetRemoteProtocol()
+			srcOpts.path = path
+			c.builder.addGithubRepo(repo, srcOpts)
+			added++
+		}
+		if res.NextPage == 0 {
+			break
+		}
+		opts.Page = res.NextPage
+	}
+	slog.Debug("Added GitHub sources.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+func (c *sourceGatherer) gatherGithubOrgSources(
+	ctx context.Context,
+	cfg *configpb.GithubOrgSource,
+) error {
+	client, srcOpts, err := c.githubAuth(cfg)
+	if err != nil {
+		return err
+	}
+	opts := &github.RepositoryListByOrgOptions{Type: "all"}
+	list := func(lopts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+		opts.ListOptions = lopts
+		repos, res, err := client.Repositories.ListByOrg(ctx, cfg.GetOrg(), opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: org %v: %w", errGithubListFailed, cfg.GetOrg(), err)
+		}
+		return repos, res, nil
+	}
+	return c.addGithubRepos(cfg, srcOpts, list)
+}
+
+func (c *sourceGatherer) gatherGithubUserSources(
+	ctx context.Context,
+	cfg *configpb.GithubUserSource,
+) error {
+	client, srcOpts, err := c.githubAuth(cfg)
+	if err != nil {
+		return err
+	}
+
+	// The public user endpoint never returns private repositories, so we use the authenticated one
+	// when the token belongs to the requested user.
+	var isOwner bool
+	if srcOpts.fetchFlags != nil {
+		user, _, err := client.Users.Get(ctx, "")
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidGithubToken, err)
+		}
+		isOwner = user.GetLogin() == cfg.GetUser()
+	}
+
+	list := func(lopts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+		var repos []*github.Repository
+		var res *github.Response
+		var err error
+		if isOwner {
+			repos, res, err = client.Repositories.ListByAuthenticatedUser(
+				ctx,
+				&github.RepositoryListByAuthenticatedUserOptions{Affiliation: "owner", ListOptions: lopts},
+			)
+		} else {
+			repos, res, err = client.Repositories.ListByUser(
+				ctx,
+				cfg.GetUser(),
+				&github.RepositoryListByUserOptions{Type: "owner", ListOptions: lopts},
+			)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: user %v: %w", errGithubListFailed, cfg.GetUser(), err)
+		}
+		return repos, res, nil
+	}
+	return c.addGithubRepos(cfg, srcOpts, list)
+}
+
+func (c *sourceGatherer) gatherGithubStarredSources(
+	ctx context.Context,
+	cfg *configpb.GithubStarredSource,
+) error {
+	client, srcOpts, err := c.githubAuth(cfg)
+	if err != nil {
+		return err
+	}
+	opts := &github.ActivityListStarredOptions{}
+	list := func(lopts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+		opts.ListOptions = lopts
+		starred, res, err := client.Activity.ListStarred(ctx, cfg.GetUser(), opts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: starred by %q: %w", errGithubListFailed, cfg.GetUser(), err)
+		}
+		repos := make([]*github.Repository, 0, len(starred))
+		for _, star := range starred {
+			repos = append(repos, star.GetRepository())
+		}
+		return repos, res, nil
+	}
+	return c.addGithubRepos(cfg, srcOpts, list)
+}
+
+func (c *sourceGatherer) gatherGithubSearchSources(
+	ctx context.Context,
+	cfg *configpb.GithubSearchSource,
+) error {
+	client, srcOpts, err := c.githubAuth(cfg)
+	if err != nil {
+		return err
+	}
+	list := func(lopts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+		res, gres, err := client.Search.Repositories(ctx, cfg.GetQuery(), &github.SearchOptions{
+			ListOptions: lopts,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: query %q: %w", errGithubListFailed, cfg.GetQuery(), err)
+		}
+		if res.GetIncompleteResults() {
+			slog.Warn("Incomplete GitHub search results.", slog.String("query", cfg.GetQuery()))
+		}
+		return res.Repositories, gres, nil
+	}
+	return c.addGithubRepos(cfg, srcOpts, list)
+}
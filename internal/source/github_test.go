@@ -0,0 +1,398 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-github/v66/github"
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/effect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// swapGithubServer redirects GitHub API calls to a local server using the provided handler.
+func swapGithubServer(t *testing.T, handler http.Handler) func() {
+	server := httptest.NewServer(handler)
+	baseURL, err := url.Parse(server.URL + "/")
+	require.NoError(t, err)
+	restore := effect.Swap(&newGithubClient, func(httpClient *http.Client) *github.Client {
+		client := github.NewClient(httpClient)
+		client.BaseURL = baseURL
+		return client
+	})
+	return func() {
+		restore()
+		server.Close()
+	}
+}
+
+func githubRepoJSON(owner, name string) map[string]any {
+	return map[string]any{
+		"name":           name,
+		"full_name":      owner + "/" + name,
+		"default_branch": "main",
+		"clone_url":      "https://github.com/" + owner + "/" + name + ".git",
+		"ssh_url":        "git@github.com:" + owner + "/" + name + ".git",
+		"owner":          map[string]any{"login": owner},
+	}
+}
+
+func TestLoadSources_GithubOrg(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/acme/repos", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "all", r.URL.Query().Get("type"))
+		var repos []map[string]any
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+			fork := githubRepoJSON("acme", "fork")
+			fork["fork"] = true
+			repos = append(repos, githubRepoJSON("acme", "one"), fork)
+		case "2":
+			archived := githubRepoJSON("acme", "old")
+			archived["archived"] = true
+			repos = append(repos, githubRepoJSON("acme", "two"), archived)
+		}
+		_ = json.NewEncoder(w).Encode(repos)
+	})
+	defer swapGithubServer(t, mux)()
+
+	t.Run("all pages", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubOrg{
+				FromGithubOrg: &configpb.GithubOrgSource{Org: "acme"},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "acme/one", srcs[0].FullName)
+		assert.Equal(t, "acme/two", srcs[1].FullName)
+		assert.Equal(t, "https://github.com/acme/two.git", srcs[1].FetchURL)
+		assert.Empty(t, srcs[1].FetchFlags)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubOrg{
+				FromGithubOrg: &configpb.GithubOrgSource{
+					Org:             "acme",
+					Token:           "secret",
+					IncludeForks:    true,
+					IncludeArchived: true,
+					Filters:         []string{"acme/o*", "acme/f*"},
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 3)
+		assert.Equal(t, "acme/old", srcs[2].FullName)
+		assert.NotEmpty(t, srcs[2].FetchFlags)
+	})
+
+	t.Run("owner path template", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubOrg{
+				FromGithubOrg: &configpb.GithubOrgSource{
+					Org:          "acme",
+					PathTemplate: "{{ .Owner }}-{{ .Name }}",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "acme-one", srcs[0].RelPath)
+	})
+
+	t.Run("missing org", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubOrg{
+				FromGithubOrg: &configpb.GithubOrgSource{Org: "missing"},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errGithubListFailed)
+	})
+}
+
+func TestLoadSources_GithubUser(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"login": "ann"})
+	})
+	mux.HandleFunc("/user/repos", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "owner", r.URL.Query().Get("affiliation"))
+		_ = json.NewEncoder(w).Encode([]map[string]any{
+			githubRepoJSON("ann", "public"),
+			githubRepoJSON("ann", "private"),
+		})
+	})
+	mux.HandleFunc("/users/ann/repos", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]any{githubRepoJSON("ann", "public")})
+	})
+	defer swapGithubServer(t, mux)()
+
+	t.Run("public", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubUser{
+				FromGithubUser: &configpb.GithubUserSource{User: "ann"},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "ann/public", srcs[0].FullName)
+	})
+
+	t.Run("owner token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubUser{
+				FromGithubUser: &configpb.GithubUserSource{
+					User:           "ann",
+					Token:          "secret",
+					RemoteProtocol: configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL,
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "ann/private", srcs[1].FullName)
+		assert.Equal(t, "git@github.com:ann/private.git", srcs[1].FetchURL)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubUser{
+				FromGithubUser: &configpb.GithubUserSource{User: "ann", Token: "abc"},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidGithubToken)
+	})
+}
+
+func TestLoadSources_GithubEnterprise(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v3/repos/acme/tool", func(w http.ResponseWriter, _ *http.Request) {
+		repo := githubRepoJSON("acme", "tool")
+		repo["description"] = "Internal tool"
+		_ = json.NewEncoder(w).Encode(repo)
+	})
+	mux.HandleFunc("/api/v3/user/repos", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]map[string]any{githubRepoJSON("acme", "private")})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("URL with mapped host", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromUrl{
+				FromUrl: &configpb.UrlSource{Url: "https://ghe.example.com/acme/tool"},
+			},
+		}}, &configpb.Options{
+			GithubApiUrls: map[string]string{"ghe.example.com": server.URL},
+		})
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "acme/tool", srcs[0].FullName)
+		assert.Equal(t, "Internal tool", srcs[0].Description)
+		assert.Equal(t, "main", srcs[0].DefaultBranch)
+	})
+
+	t.Run("URL with mapped host private repo", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromUrl{
+				FromUrl: &configpb.UrlSource{Url: "https://ghe.example.com/acme/secret"},
+			},
+		}}, &configpb.Options{
+			GithubApiUrls: map[string]string{"ghe.example.com": server.URL},
+		})
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "acme/secret", srcs[0].FullName)
+		assert.Equal(t, "https://ghe.example.com/acme/secret", srcs[0].FetchURL)
+	})
+
+	t.Run("URL with unmapped host", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromUrl{
+				FromUrl: &configpb.UrlSource{Url: "https://ghe.example.com/acme/tool"},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Empty(t, srcs[0].Description)
+	})
+
+	t.Run("token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubToken{
+				FromGithubToken: &configpb.GithubTokenSource{
+					Token:  "secret",
+					ApiUrl: server.URL,
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "acme/private", srcs[0].FullName)
+	})
+}
+
+func TestLoadSources_GithubStarred(t *testing.T) {
+	ctx := context.Background()
+
+	starred := func(repos ...map[string]any) []map[string]any {
+		var stars []map[string]any
+		for _, repo := range repos {
+			stars = append(stars, map[string]any{"repo": repo})
+		}
+		return stars
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/user/starred", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(starred(githubRepoJSON("acme", "lib")))
+	})
+	mux.HandleFunc("/users/ann/starred", func(w http.ResponseWriter, r *http.Request) {
+		var stars []map[string]any
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+			stars = starred(githubRepoJSON("acme", "one"), githubRepoJSON("other", "two"))
+		case "2":
+			stars = starred(githubRepoJSON("acme", "three"))
+		}
+		_ = json.NewEncoder(w).Encode(stars)
+	})
+	defer swapGithubServer(t, mux)()
+
+	t.Run("token owner", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubStarred{
+				FromGithubStarred: &configpb.GithubStarredSource{Token: "secret"},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "acme/lib", srcs[0].FullName)
+	})
+
+	t.Run("named user", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubStarred{
+				FromGithubStarred: &configpb.GithubStarredSource{
+					User:         "ann",
+					Filters:      []string{"acme/*"},
+					PathTemplate: "stars/{{ .FullName }}",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "acme/one", srcs[0].FullName)
+		assert.Equal(t, "stars/acme/three", srcs[1].RelPath)
+	})
+
+	t.Run("missing token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubStarred{
+				FromGithubStarred: &configpb.GithubStarredSource{},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errGithubListFailed)
+	})
+}
+
+func TestLoadSources_GithubSearch(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/search/repositories", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") != "topic:tooling org:acme" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		var repos []map[string]any
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", `<`+r.URL.Path+`?page=2>; rel="next"`)
+			archived := githubRepoJSON("acme", "old")
+			archived["archived"] = true
+			repos = append(repos, githubRepoJSON("acme", "one"), archived)
+		case "2":
+			repos = append(repos, githubRepoJSON("acme", "two"))
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"total_count": 3, "items": repos})
+	})
+	defer swapGithubServer(t, mux)()
+
+	t.Run("matching query", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubSearch{
+				FromGithubSearch: &configpb.GithubSearchSource{
+					Query:        "topic:tooling org:acme",
+					PathTemplate: "{{ .Name }}",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "acme/one", srcs[0].FullName)
+		assert.Equal(t, "two", srcs[1].RelPath)
+	})
+
+	t.Run("invalid query", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubSearch{
+				FromGithubSearch: &configpb.GithubSearchSource{Query: "foo:"},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errGithubListFailed)
+	})
+}
+
+func TestGithubSourceID(t *testing.T) {
+	for key, tc := range map[string]struct {
+		repo *github.Repository
+		want string
+	}{
+		"github.com": {
+			repo: &github.Repository{ID: addr(int64(123)), HTMLURL: addr("https://github.com/ann/one")},
+			want: "github:github.com:123",
+		},
+		"enterprise": {
+			repo: &github.Repository{ID: addr(int64(123)), HTMLURL: addr("https://ghe.example.com/ann/one")},
+			want: "github:ghe.example.com:123",
+		},
+		"missing ID":  {repo: &github.Repository{HTMLURL: addr("https://github.com/ann/one")}},
+		"missing URL": {repo: &github.Repository{ID: addr(int64(123))}},
+	} {
+		t.Run(key, func(t *testing.T) {
+			assert.Equal(t, tc.want, githubSourceID(tc.repo))
+		})
+	}
+}
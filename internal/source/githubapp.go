@@ -0,0 +1,157 @@
+package source
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v66/github"
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+const (
+	// githubAppTokenMargin is the minimum remaining validity of a cached installation token. Tokens
+	// closer to expiry are refreshed.
+	githubAppTokenMargin = 5 * time.Minute
+
+	// githubAppJWTLifetime is the validity of JWTs used to mint installation tokens. GitHub allows at
+	// most 10 minutes.
+	githubAppJWTLifetime = 9 * time.Minute
+)
+
+// timeNow is swapped out for testing.
+var timeNow = time.Now
+
+// githubAppTokens mints and caches GitHub App installation tokens. It is safe for concurrent use.
+type githubAppTokens struct {
+	client         *github.Client
+	appID          int64
+	installationID int64
+	key            *rsa.PrivateKey
+	// Transport wrapped by RoundTrip, the same as the client's so that requests are retried.
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+func newGithubAppTokens(
+	client *github.Client,
+	cfg *configpb.GithubAppAuth,
+) (*githubAppTokens, error) {
+	data, err := os.ReadFile(cfg.GetPrivateKeyPath())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidGithubAppAuth, err)
+	}
+	key, err := parseRSAPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidGithubAppAuth, err)
+	}
+	return &githubAppTokens{
+		client:         client,
+		appID:          cfg.GetAppId(),
+		installationID: cfg.GetInstallationId(),
+		key:            key,
+		base:           client.Client().Transport,
+	}, nil
+}
+
+// Token returns a valid installation token, minting a new one if needed.
+func (t *githubAppTokens) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && timeNow().Add(githubAppTokenMargin).Before(t.expiresAt) {
+		return t.token, nil
+	}
+	jwt, err := t.signJWT()
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidGithubAppAuth, err)
+	}
+	res, _, err := t.client.WithAuthToken(jwt).Apps.CreateInstallationToken(ctx, t.installationID, nil)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errInvalidGithubAppAuth, err)
+	}
+	t.token = res.GetToken()
+	t.expiresAt = res.GetExpiresAt().Time
+	return t.token, nil
+}
+
+// signJWT returns a token authenticating as the app itself, as described in
+// https://docs.github.com/en/apps/creating-github-apps/authenticating-with-a-github-app/generating-a-json-web-token-jwt-for-a-github-app.
+func (t *githubAppTokens) signJWT() (string, error) {
+	now := timeNow()
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		// Backdated to allow for clock drift.
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(githubAppJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(t.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	payload := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return payload + "." + enc.EncodeToString(sig), nil
+}
+
+// RoundTrip implements http.RoundTripper, authenticating requests with an installation token.
+func (t *githubAppTokens) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Token(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(req)
+}
+
+// fetchFlags returns git flags authenticating fetches with a valid installation token.
+func (t *githubAppTokens) fetchFlags(ctx context.Context) ([]string, error) {
+	token, err := t.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return credentialFlags("x-access-token", token), nil
+}
+
+func parseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errMissingPEMBlock
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", errUnexpectedKeyType, parsed)
+	}
+	return key, nil
+}
@@ -0,0 +1,181 @@
+package source
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/effect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestLoadSources_GithubApp(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Now()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), 0600))
+
+	var minted atomic.Int32
+	mux := http.NewServeMux()
+	tokenPath := "POST /app/installations/42/access_tokens"
+	mux.HandleFunc(tokenPath, func(w http.ResponseWriter, r *http.Request) {
+		jwt, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		payload, encoded, _ := strings.Cut(jwt, ".")
+		claims, encoded, _ := strings.Cut(encoded, ".")
+		sig, _ := base64.RawURLEncoding.DecodeString(encoded)
+		digest := sha256.Sum256([]byte(payload + "." + claims))
+		if rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig) != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := minted.Add(1)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"token":      fmt.Sprintf("token-%d", n),
+			"expires_at": t0.Add(time.Hour).Format(time.RFC3339),
+		})
+	})
+	var flaky atomic.Bool
+	mux.HandleFunc("/installation/repositories", func(w http.ResponseWriter, r *http.Request) {
+		if flaky.CompareAndSwap(true, false) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"total_count":  1,
+			"repositories": []map[string]any{githubRepoJSON("acme", "app")},
+		})
+	})
+	defer swapGithubServer(t, mux)()
+
+	t.Run("valid credentials", func(t *testing.T) {
+		defer effect.Swap(&timeNow, func() time.Time { return t0 })()
+
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubToken{
+				FromGithubToken: &configpb.GithubTokenSource{
+					AppAuth: &configpb.GithubAppAuth{
+						AppId:          1,
+						PrivateKeyPath: keyPath,
+						InstallationId: 42,
+					},
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "acme/app", srcs[0].FullName)
+		assert.Equal(t, int32(1), minted.Load())
+
+		flags, err := srcs[0].ResolveFetchFlags(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, flags[1], "password=token-1")
+		assert.Equal(t, int32(1), minted.Load())
+
+		// Tokens close to expiry are refreshed.
+		timeNow = func() time.Time { return t0.Add(58 * time.Minute) }
+		flags, err = srcs[0].ResolveFetchFlags(ctx)
+		require.NoError(t, err)
+		assert.Contains(t, flags[1], "password=token-2")
+	})
+
+	t.Run("transient failure", func(t *testing.T) {
+		defer effect.Swap(&timeNow, func() time.Time { return t0 })()
+		flaky.Store(true)
+
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubToken{
+				FromGithubToken: &configpb.GithubTokenSource{
+					AppAuth: &configpb.GithubAppAuth{
+						AppId:          1,
+						PrivateKeyPath: keyPath,
+						InstallationId: 42,
+					},
+				},
+			},
+		}}, &configpb.Options{
+			Retry: &configpb.RetryOptions{InitialDelay: durationpb.New(time.Millisecond)},
+		})
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.False(t, flaky.Load())
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubOrg{
+				FromGithubOrg: &configpb.GithubOrgSource{
+					Org: "acme",
+					AppAuth: &configpb.GithubAppAuth{
+						AppId:          1,
+						PrivateKeyPath: filepath.Join(t.TempDir(), "missing.pem"),
+						InstallationId: 42,
+					},
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidGithubAppAuth)
+	})
+
+	t.Run("unknown installation", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGithubToken{
+				FromGithubToken: &configpb.GithubTokenSource{
+					AppAuth: &configpb.GithubAppAuth{
+						AppId:          1,
+						PrivateKeyPath: keyPath,
+						InstallationId: 7,
+					},
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidGithubAppAuth)
+	})
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	t.Run("PKCS8", func(t *testing.T) {
+		data, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		got, err := parseRSAPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}))
+		require.NoError(t, err)
+		assert.True(t, key.Equal(got))
+	})
+
+	t.Run("missing block", func(t *testing.T) {
+		_, err := parseRSAPrivateKey([]byte("foo"))
+		assert.ErrorIs(t, err, errMissingPEMBlock)
+	})
+}
@@ -0,0 +1,104 @@
+package source
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+const defaultGitlabURL = "https://gitlab.com"
+
+// gitlabProject contains the subset of GitLab's project representation used to create sources.
+// See https://docs.gitlab.com/ee/api/projects.html.
+type gitlabProject struct {
+	Path              string    `json:"path"`
+	PathWithNamespace string    `json:"path_with_namespace"`
+	Description       string    `json:"description"`
+	DefaultBranch     string    `json:"default_branch"`
+	HTTPURLToRepo     string    `json:"http_url_to_repo"`
+	SSHURLToRepo      string    `json:"ssh_url_to_repo"`
+	Archived          bool      `json:"archived"`
+	ForkedFromProject *struct{} `json:"forked_from_project"`
+	Namespace         struct {
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+}
+
+func (c *sourceGatherer) gatherGitlabTokenSources(
+	ctx context.Context,
+	cfg *configpb.GitlabTokenSource,
+) error {
+	token := expandToken(cfg.GetToken())
+	flags := credentialFlags("oauth2", token)
+	header := http.Header{"Private-Token": []string{token}}
+
+	filter, err := newRepoFilter(cfg)
+	if err != nil {
+		return err
+	}
+
+	baseURL := strings.TrimSuffix(cmp.Or(cfg.GetBaseUrl(), defaultGitlabURL), "/")
+	query := url.Values{"membership": {"true"}, "per_page": {"50"}, "order_by": {"id"}}
+	var added, skipped int
+	for page := "1"; page != ""; {
+		query.Set("page", page)
+		var projects []gitlabProject
+		resHeader, err := getJSON(ctx, c.httpClient, baseURL+"/api/v4/projects?"+query.Encode(), header, &projects)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errInvalidGitlabToken, err)
+		}
+		for _, project := range projects {
+			isFork := project.ForkedFromProject != nil
+			if !filter.accept(project.PathWithNamespace, isFork, project.Archived) {
+				skipped++
+				continue
+			}
+
+			path, err := templateSourcePath(
+				cfg.GetPathTemplate(),
+				project.PathWithNamespace,
+				project.Path,
+				project.Namespace.FullPath,
+			)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidPath, err)
+			}
+
+			c.builder.addGitlabProject(&project, sourceOptions{
+				fetchFlags:     flags,
+				remoteProtocol: cfg.GetRemoteProtocol(),
+				path:           path,
+			})
+			added++
+		}
+		page = resHeader.Get("X-Next-Page") // Empty on the last page.
+	}
+	slog.Debug("Added GitLab source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+func (b *sourcesBuilder) addGitlabProject(project *gitlabProject, opts sourceOptions) {
+	// GitLab updates projects' last_activity_at at most once per hour, so it can predate pushes
+	// which happened since the last sync. No listed field changes on every push, so LastUpdatedAt is
+	// left unset to always fetch.
+	src := Source{
+		FullName:      project.PathWithNamespace,
+		Description:   project.Description,
+		DefaultBranch: cmp.Or(opts.defaultBranch, project.DefaultBranch),
+		RelPath:       opts.path,
+		FetchFlags:    opts.fetchFlags,
+	}
+	switch opts.remoteProtocol {
+	case configpb.RemoteProtocol_DEFAULT_REMOTE_PROTOCOL:
+		src.FetchURL = project.HTTPURLToRepo
+	case configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL:
+		src.FetchURL = project.SSHURLToRepo
+	}
+	*b = append(*b, src)
+}
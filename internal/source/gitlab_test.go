@@ -0,0 +1,109 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSources_Gitlab(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Private-Token") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var projects []map[string]any
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			projects = []map[string]any{{
+				"path":                "one",
+				"path_with_namespace": "team/one",
+				"description":         "First project",
+				"default_branch":      "main",
+				"last_activity_at":    t0.Format(time.RFC3339),
+				"http_url_to_repo":    "https://gitlab.example.com/team/one.git",
+				"ssh_url_to_repo":     "git@gitlab.example.com:team/one.git",
+				"namespace":           map[string]any{"full_path": "team"},
+			}, {
+				"path":                "archived",
+				"path_with_namespace": "team/archived",
+				"archived":            true,
+			}}
+		case "2":
+			projects = []map[string]any{{
+				"path":                "fork",
+				"path_with_namespace": "team/sub/fork",
+				"default_branch":      "master",
+				"forked_from_project": map[string]any{"id": 1},
+				"http_url_to_repo":    "https://gitlab.example.com/team/sub/fork.git",
+				"ssh_url_to_repo":     "git@gitlab.example.com:team/sub/fork.git",
+				"namespace":           map[string]any{"full_path": "team/sub"},
+			}}
+		}
+		_ = json.NewEncoder(w).Encode(projects)
+	}))
+	defer server.Close()
+
+	t.Run("default options", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGitlabToken{
+				FromGitlabToken: &configpb.GitlabTokenSource{
+					Token:   "secret",
+					BaseUrl: server.URL,
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "team/one", srcs[0].FullName)
+		assert.Equal(t, "First project", srcs[0].Description)
+		assert.Equal(t, "main", srcs[0].DefaultBranch)
+		assert.Equal(t, "https://gitlab.example.com/team/one.git", srcs[0].FetchURL)
+		assert.True(t, srcs[0].LastUpdatedAt.IsZero())
+		assert.Contains(t, srcs[0].FetchFlags[1], "password=secret")
+	})
+
+	t.Run("forks, filters, and templates", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGitlabToken{
+				FromGitlabToken: &configpb.GitlabTokenSource{
+					Token:          "secret",
+					BaseUrl:        server.URL + "/",
+					IncludeForks:   true,
+					Filters:        []string{"team/sub/*"},
+					RemoteProtocol: configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL,
+					PathTemplate:   "{{ .Owner }}-{{ .Name }}",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "team/sub/fork", srcs[0].FullName)
+		assert.Equal(t, "team/sub-fork", srcs[0].RelPath)
+		assert.Equal(t, "git@gitlab.example.com:team/sub/fork.git", srcs[0].FetchURL)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromGitlabToken{
+				FromGitlabToken: &configpb.GitlabTokenSource{
+					Token:   "abc",
+					BaseUrl: server.URL,
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidGitlabToken)
+	})
+}
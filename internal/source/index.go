@@ -0,0 +1,118 @@
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/fspath"
+)
+
+// cgitRepoPattern matches repository links in cgit's index page.
+var cgitRepoPattern = regexp.MustCompile(`<td class='(?:top|sub)level-repo'><a [^>]*href='([^']+)'`)
+
+func (c *sourceGatherer) gatherIndexSources(
+	ctx context.Context,
+	cfg *configpb.IndexSource,
+) error {
+	indexURL, err := url.Parse(cfg.GetUrl())
+	if err != nil || indexURL.Host == "" {
+		return fmt.Errorf("%w: %s", errInvalidURL, cfg.GetUrl())
+	}
+
+	prefix := cfg.GetCloneUrlPrefix()
+	if prefix == "" {
+		if cfg.GetFormat() != configpb.IndexSource_CGIT_FORMAT {
+			return fmt.Errorf("%w: missing clone URL prefix for %s", errInvalidURL, cfg.GetUrl())
+		}
+		prefix = (&url.URL{
+			Scheme: indexURL.Scheme,
+			User:   indexURL.User,
+			Host:   indexURL.Host,
+			Path:   indexURL.Path,
+		}).String()
+	}
+
+	if cfg.GetFormat() == configpb.IndexSource_GITWEB_FORMAT {
+		query := indexURL.Query()
+		query.Set("a", "project_index")
+		indexURL.RawQuery = query.Encode()
+	}
+	data, err := getText(ctx, c.httpClient, indexURL.String())
+	if err != nil {
+		return fmt.Errorf("%w: %w", errIndexListFailed, err)
+	}
+
+	var paths []fspath.POSIX
+	switch cfg.GetFormat() {
+	case configpb.IndexSource_GITWEB_FORMAT, configpb.IndexSource_PROJECTS_LIST_FORMAT:
+		paths, err = parseProjectsList(data)
+	case configpb.IndexSource_CGIT_FORMAT:
+		paths, err = parseCgitIndex(data, indexURL.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errIndexListFailed, err)
+	}
+
+	pred, err := newNamePredicate(cfg.GetFilters())
+	if err != nil {
+		return err
+	}
+
+	var added, skipped int
+	for _, fp := range paths {
+		fullName := strings.TrimSuffix(strings.Trim(fp, "/"), ".git")
+		if !pred.accept(fullName) {
+			skipped++
+			continue
+		}
+		fetchURL := strings.TrimSuffix(prefix, "/") + "/" + strings.Trim(fp, "/")
+		c.builder.addIndexRepo(fullName, fetchURL)
+		added++
+	}
+	slog.Debug("Added index source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+func (b *sourcesBuilder) addIndexRepo(fullName, fetchURL string) {
+	*b = append(*b, Source{FullName: fullName, FetchURL: fetchURL})
+}
+
+// parseProjectsList returns repository paths from a gitweb projects list, where each line contains
+// a URL-encoded path optionally followed by a space and URL-encoded owner.
+func parseProjectsList(data []byte) ([]fspath.POSIX, error) {
+	var paths []fspath.POSIX
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		field, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if field == "" {
+			continue
+		}
+		fp, err := url.QueryUnescape(field)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, fp)
+	}
+	return paths, scanner.Err()
+}
+
+// parseCgitIndex returns repository paths linked from a cgit index page, relative to the index's
+// own path (cgit's virtual root).
+func parseCgitIndex(data []byte, root fspath.POSIX) ([]fspath.POSIX, error) {
+	var paths []fspath.POSIX
+	for _, match := range cgitRepoPattern.FindAllSubmatch(data, -1) {
+		fp, err := url.PathUnescape(string(match[1]))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, strings.TrimPrefix(fp, root))
+	}
+	return paths, nil
+}
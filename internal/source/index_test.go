@@ -0,0 +1,115 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSources_Index(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gitweb.cgi", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("a") != "project_index" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte("mtth/gitfetcher.git git\nnodejs/node.git\nmy+project.git Ann+Owner\n"))
+	})
+	mux.HandleFunc("/projects.list", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("one.git\n\nteam/two.git\n"))
+	})
+	mux.HandleFunc("/cgit/", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`<table class='list nowrap'>
+<tr class='nohover-highlight'><td colspan='4' class='reposection'>tools</td></tr>
+<tr><td class='sublevel-repo'><a title='tools/one' href='/cgit/tools/one/'>one</a></td></tr>
+<tr><td class='toplevel-repo'><a title='two.git' href='/cgit/two.git/'>two.git</a></td></tr>
+</table>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("gitweb", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromIndex{
+				FromIndex: &configpb.IndexSource{
+					Url:            server.URL + "/gitweb.cgi",
+					CloneUrlPrefix: "https://mirror.example.com/git/",
+					Filters:        []string{"mtth/*", "my project"},
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []Source{{
+			FullName: "mtth/gitfetcher",
+			FetchURL: "https://mirror.example.com/git/mtth/gitfetcher.git",
+		}, {
+			FullName: "my project",
+			FetchURL: "https://mirror.example.com/git/my project.git",
+		}}, srcs)
+	})
+
+	t.Run("projects list", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromIndex{
+				FromIndex: &configpb.IndexSource{
+					Url:            server.URL + "/projects.list",
+					Format:         configpb.IndexSource_PROJECTS_LIST_FORMAT,
+					CloneUrlPrefix: "git://mirror.example.com",
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, "team/two", srcs[1].FullName)
+		assert.Equal(t, "git://mirror.example.com/team/two.git", srcs[1].FetchURL)
+	})
+
+	t.Run("cgit", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromIndex{
+				FromIndex: &configpb.IndexSource{
+					Url:    server.URL + "/cgit/",
+					Format: configpb.IndexSource_CGIT_FORMAT,
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []Source{{
+			FullName: "tools/one",
+			FetchURL: server.URL + "/cgit/tools/one",
+		}, {
+			FullName: "two",
+			FetchURL: server.URL + "/cgit/two.git",
+		}}, srcs)
+	})
+
+	t.Run("missing prefix", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromIndex{
+				FromIndex: &configpb.IndexSource{Url: server.URL + "/gitweb.cgi"},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidURL)
+	})
+
+	t.Run("missing index", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromIndex{
+				FromIndex: &configpb.IndexSource{
+					Url:    server.URL + "/missing",
+					Format: configpb.IndexSource_CGIT_FORMAT,
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errIndexListFailed)
+	})
+}
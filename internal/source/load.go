@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"log/slog"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
@@ -15,26 +16,65 @@ import (
 	"github.com/google/go-github/v66/github"
 	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
 	"github.com/mtth/gitfetcher/internal/fspath"
+	"github.com/mtth/gitfetcher/internal/retry"
 )
 
-// Load returns all sources for the provided configuration.
-func Load(ctx context.Context, configs []*configpb.Source) ([]Source, error) {
+// Load returns all sources for the provided configuration. Options may be nil.
+func Load(
+	ctx context.Context,
+	configs []*configpb.Source,
+	opts *configpb.Options,
+) ([]Source, error) {
 	slog.Debug("Loading sources...")
 
+	// API requests which fail transiently are retried transparently.
+	httpClient := &http.Client{Transport: &retry.Transport{Policy: retry.NewPolicy(opts.GetRetry())}}
 	var builder sourcesBuilder
-	gatherer := &sourceGatherer{builder: &builder, githubClient: github.NewClient(nil)}
+	gatherer := &sourceGatherer{
+		builder:       &builder,
+		githubClient:  newGithubClient(httpClient),
+		githubAPIURLs: opts.GetGithubApiUrls(),
+		httpClient:    httpClient,
+	}
 	var errs []error
 	for _, config := range configs {
+		start := len(builder)
 		var err error
 		switch b := config.GetBranch().(type) {
 		case *configpb.Source_FromUrl:
 			err = gatherer.gatherURLSource(ctx, b.FromUrl)
 		case *configpb.Source_FromGithubToken:
 			err = gatherer.gatherGithubTokenSources(ctx, b.FromGithubToken)
+		case *configpb.Source_FromGitlabToken:
+			err = gatherer.gatherGitlabTokenSources(ctx, b.FromGitlabToken)
+		case *configpb.Source_FromGitea:
+			err = gatherer.gatherGiteaSources(ctx, b.FromGitea)
+		case *configpb.Source_FromGithubOrg:
+			err = gatherer.gatherGithubOrgSources(ctx, b.FromGithubOrg)
+		case *configpb.Source_FromGithubUser:
+			err = gatherer.gatherGithubUserSources(ctx, b.FromGithubUser)
+		case *configpb.Source_FromGithubStarred:
+			err = gatherer.gatherGithubStarredSources(ctx, b.FromGithubStarred)
+		case *configpb.Source_FromGithubSearch:
+			err = gatherer.gatherGithubSearchSources(ctx, b.FromGithubSearch)
+		case *configpb.Source_FromCommand:
+			err = gatherer.gatherCommandSources(ctx, b.FromCommand)
+		case *configpb.Source_FromManifest:
+			err = gatherer.gatherManifestSources(ctx, b.FromManifest)
+		case *configpb.Source_FromBitbucketCloud:
+			err = gatherer.gatherBitbucketCloudSources(ctx, b.FromBitbucketCloud)
+		case *configpb.Source_FromBitbucketServer:
+			err = gatherer.gatherBitbucketServerSources(ctx, b.FromBitbucketServer)
+		case *configpb.Source_FromSourcehut:
+			err = gatherer.gatherSourcehutSources(ctx, b.FromSourcehut)
+		case *configpb.Source_FromIndex:
+			err = gatherer.gatherIndexSources(ctx, b.FromIndex)
+		case *configpb.Source_FromLocalDir:
+			err = gatherer.gatherLocalDirSources(ctx, b.FromLocalDir)
 		default:
 			return nil, fmt.Errorf("%w: %v", errUnexpectedConfig, config)
 		}
-		errs = append(errs, err)
+		errs = append(errs, err, builder.applyCommonOptions(start, config))
 	}
 
 	if err := errors.Join(errs...); err != nil {
@@ -45,16 +85,36 @@ func Load(ctx context.Context, configs []*configpb.Source) ([]Source, error) {
 	return srcs, nil
 }
 
+// newGithubClient returns the client used to access GitHub's API. It is swapped out for testing.
+var newGithubClient = func(httpClient *http.Client) *github.Client {
+	return github.NewClient(httpClient)
+}
+
 var (
-	errInvalidGithubToken = errors.New("invalid GitHub token")
-	errInvalidPath        = errors.New("invalid path")
-	errUnexpectedConfig   = errors.New("unexpected config")
-	errInvalidURL         = errors.New("invalid URL")
+	errInvalidGithubToken   = errors.New("invalid GitHub token")
+	errGithubListFailed     = errors.New("unable to list GitHub repositories")
+	errInvalidGithubAppAuth = errors.New("invalid GitHub App authentication")
+	errMissingPEMBlock      = errors.New("missing PEM block")
+	errUnexpectedKeyType    = errors.New("unexpected private key type")
+	errCommandFailed        = errors.New("source command failed")
+	errInvalidCommandOutput = errors.New("invalid source command output")
+	errInvalidManifest      = errors.New("invalid manifest")
+	errBitbucketListFailed  = errors.New("unable to list Bitbucket repositories")
+	errSourcehutListFailed  = errors.New("unable to list SourceHut repositories")
+	errIndexListFailed      = errors.New("unable to list index repositories")
+	errInvalidGitlabToken   = errors.New("invalid GitLab token")
+	errGiteaRequestFailed   = errors.New("request to Gitea failed")
+	errInvalidPath          = errors.New("invalid path")
+	errUnexpectedConfig     = errors.New("unexpected config")
+	errInvalidURL           = errors.New("invalid URL")
+	errInvalidRefPattern    = errors.New("invalid branch pattern")
 )
 
 type sourceGatherer struct {
-	builder      *sourcesBuilder
-	githubClient *github.Client
+	builder       *sourcesBuilder
+	githubClient  *github.Client
+	githubAPIURLs map[string]string
+	httpClient    *http.Client
 }
 
 func (c *sourceGatherer) gatherURLSource(
@@ -69,80 +129,79 @@ func (c *sourceGatherer) gatherURLSource(
 		defaultBranch: cfg.GetDefaultBranch(),
 		path:          cfg.GetPath(),
 	}
-	switch repoURL.Hostname() {
-	case "github.com":
-		folder, name := path.Split(fullNameFromURL(repoURL))
-		repo, _, err := c.githubClient.Repositories.Get(ctx, strings.TrimSuffix(folder, "/"), name)
+	host := repoURL.Hostname()
+	if apiURL, ok := c.githubAPIURLs[host]; ok || host == "github.com" {
+		client, err := c.githubClientFor(apiURL)
 		if err != nil {
+			return err
+		}
+		folder, name := path.Split(fullNameFromURL(repoURL))
+		repo, _, err := client.Repositories.Get(ctx, strings.TrimSuffix(folder, "/"), name)
+		switch {
+		case ok && isGithubAccessError(err):
+			// Private repositories of Enterprise Server hosts aren't visible without a token, we
+			// fall back to the information in the URL.
+			slog.Debug("Unable to get GitHub repository.", slog.String("url", repoURL.String()))
+			c.builder.addStandardURLRepo(repoURL, opts)
+		case err != nil:
 			return fmt.Errorf("unable to get source from URL %v: %w", repoURL, err)
+		default:
+			c.builder.addGithubRepo(repo, opts)
 		}
-		c.builder.addGithubRepo(repo, opts)
-	default:
+	} else {
 		c.builder.addStandardURLRepo(repoURL, opts)
 	}
 	slog.Debug("Added URL source.", slog.String("url", repoURL.String()))
 	return nil
 }
 
+// isGithubAccessError returns true iff the error is a GitHub API response denying access, which
+// hides private repositories from unauthenticated requests.
+func isGithubAccessError(err error) bool {
+	var rerr *github.ErrorResponse
+	if !errors.As(err, &rerr) || rerr.Response == nil {
+		return false
+	}
+	code := rerr.Response.StatusCode
+	return code == http.StatusUnauthorized || code == http.StatusNotFound
+}
+
 func (c *sourceGatherer) gatherGithubTokenSources(
 	ctx context.Context,
 	cfg *configpb.GithubTokenSource,
 ) error {
-	token := cfg.GetToken()
-	if suffix, ok := strings.CutPrefix(token, "$"); ok {
-		token = os.Getenv(suffix)
-	}
-
-	client := c.githubClient.WithAuthToken(token)
-	flags := []string{
-		"-c",
-		fmt.Sprintf("credential.helper=!f() { echo username=token; echo password=%v; };f", token),
-	}
-
-	pred, err := newNamePredicate(cfg.GetFilters())
+	client, srcOpts, err := c.githubAuth(cfg)
 	if err != nil {
 		return err
 	}
-
-	opts := &github.RepositoryListByAuthenticatedUserOptions{
-		ListOptions: github.ListOptions{PerPage: 50},
-	}
-	var added, skipped int
-	for {
+	opts := &github.RepositoryListByAuthenticatedUserOptions{}
+	list := func(lopts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+		opts.ListOptions = lopts
 		repos, res, err := client.Repositories.ListByAuthenticatedUser(ctx, opts)
 		if err != nil {
-			return fmt.Errorf("%w: %w", errInvalidGithubToken, err)
+			return nil, nil, fmt.Errorf("%w: %w", errInvalidGithubToken, err)
 		}
-		for _, repo := range repos {
-			if (repo.GetFork() && !cfg.GetIncludeForks()) ||
-				(repo.GetArchived() && !cfg.GetIncludeArchived()) ||
-				!pred.accept(repo.GetFullName()) {
-				skipped++
-				continue
-			}
-
-			path, err := githubSourcePath(cfg.GetPathTemplate(), repo)
+		return repos, res, nil
+	}
+	if cfg.GetAppAuth() != nil {
+		// Installation tokens are not tied to a user, their repositories are listed separately.
+		list = func(lopts github.ListOptions) ([]*github.Repository, *github.Response, error) {
+			repos, res, err := client.Apps.ListRepos(ctx, &lopts)
 			if err != nil {
-				return fmt.Errorf("%w: %v", errInvalidPath, err)
+				return nil, nil, fmt.Errorf("%w: %w", errInvalidGithubAppAuth, err)
 			}
-
-			c.builder.addGithubRepo(repo, sourceOptions{
-				fetchFlags:     flags,
-				remoteProtocol: cfg.GetRemoteProtocol(),
-				path:           path,
-			})
-			added++
-		}
-		if res.NextPage == 0 {
-			break
+			return repos.Repositories, res, nil
 		}
-		opts.Page = res.NextPage
 	}
-	slog.Debug("Added authenticated source.", slog.Int("added", added), slog.Int("skipped", skipped))
-	return nil
+	return c.addGithubRepos(cfg, srcOpts, list)
 }
 
 func githubSourcePath(tpl string, repo *github.Repository) (fspath.POSIX, error) {
+	return templateSourcePath(tpl, repo.GetFullName(), repo.GetName(), repo.GetOwner().GetLogin())
+}
+
+// templateSourcePath renders a local path template. An empty template yields an empty path.
+func templateSourcePath(tpl, fullName, name, owner string) (fspath.POSIX, error) {
 	if tpl == "" {
 		return "", nil
 	}
@@ -152,13 +211,65 @@ func githubSourcePath(tpl string, repo *github.Repository) (fspath.POSIX, error)
 	}
 	var b strings.Builder
 	err = parsed.Execute(&b, map[string]string{
-		"FullName": repo.GetFullName(),
-		"Name":     repo.GetName(),
-		"Owner":    repo.GetOwner().GetName(),
+		"FullName": fullName,
+		"Name":     name,
+		"Owner":    owner,
 	})
 	return b.String(), err
 }
 
+// expandToken returns the value of the environment variable named by token if it starts with $,
+// and token itself otherwise.
+func expandToken(token string) string {
+	if suffix, ok := strings.CutPrefix(token, "$"); ok {
+		return os.Getenv(suffix)
+	}
+	return token
+}
+
+// credentialFlags returns git flags which authenticate fetches with the given credentials. We use
+// an inline helper to avoid persisting them in the repository's configuration.
+func credentialFlags(username, password string) []string {
+	return []string{
+		"-c",
+		fmt.Sprintf("credential.helper=!f() { echo username=%v; echo password=%v; };f", username, password),
+	}
+}
+
+// bearerFlags returns git flags which authenticate fetches with a bearer token.
+func bearerFlags(token string) []string {
+	return []string{"-c", "http.extraHeader=Authorization: Bearer " + token}
+}
+
+// repoFilterConfig is implemented by configurations which support filtering repositories.
+type repoFilterConfig interface {
+	GetIncludeForks() bool
+	GetIncludeArchived() bool
+	GetFilters() []string
+}
+
+// repoFilter decides which listed repositories should be added as sources.
+type repoFilter struct {
+	includeForks, includeArchived bool
+	names                         namePredicate
+}
+
+func newRepoFilter(cfg repoFilterConfig) (*repoFilter, error) {
+	pred, err := newNamePredicate(cfg.GetFilters())
+	if err != nil {
+		return nil, err
+	}
+	return &repoFilter{
+		includeForks:    cfg.GetIncludeForks(),
+		includeArchived: cfg.GetIncludeArchived(),
+		names:           pred,
+	}, nil
+}
+
+func (f *repoFilter) accept(fullName string, isFork, isArchived bool) bool {
+	return (!isFork || f.includeForks) && (!isArchived || f.includeArchived) && f.names.accept(fullName)
+}
+
 type namePredicate []glob.Glob
 
 func newNamePredicate(pats []string) (namePredicate, error) {
@@ -4,11 +4,13 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v66/github"
 	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 func TestLoadSources_StandardURL(t *testing.T) {
@@ -22,13 +24,65 @@ func TestLoadSources_StandardURL(t *testing.T) {
 					DefaultBranch: "master",
 				},
 			},
-		}})
+		}}, nil)
 		require.NoError(t, err)
 		assert.Len(t, srcs, 1)
 		assert.Equal(t, "archlinux/devtools", srcs[0].FullName)
 		assert.Equal(t, "master", srcs[0].DefaultBranch)
 	})
 
+	t.Run("common options", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromUrl{
+				FromUrl: &configpb.UrlSource{Url: "https://example.com/slow.git"},
+			},
+			FetchTimeout: durationpb.New(time.Minute),
+			Clone: &configpb.CloneOptions{
+				Filter: configpb.CloneOptions_TREELESS_FILTER,
+				Depth:  1,
+			},
+			Refs: &configpb.RefsOptions{
+				IncludeBranches: []string{"main", "release/*"},
+				ExcludeBranches: []string{"release/old-*"},
+				Tags:            configpb.RefsOptions_NO_TAGS,
+				PullRequests:    true,
+			},
+			WorktreePolicy: configpb.WorktreePolicy_REBASE_WORKTREE_POLICY,
+		}, {
+			Branch: &configpb.Source_FromUrl{
+				FromUrl: &configpb.UrlSource{Url: "https://example.com/fast.git"},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, time.Minute, srcs[0].FetchTimeout)
+		assert.Equal(t, &CloneSettings{Filter: "tree:0", Depth: 1}, srcs[0].Clone)
+		assert.Equal(t, &RefSettings{
+			Refspecs: []string{
+				"+refs/heads/main:refs/remotes/origin/main",
+				"+refs/heads/release/*:refs/remotes/origin/release/*",
+				"^refs/heads/release/old-*",
+				"+refs/pull/*/head:refs/remotes/origin/pull/*",
+			},
+			TagOpt: "--no-tags",
+		}, srcs[0].Refs)
+		assert.Zero(t, srcs[1].FetchTimeout)
+		assert.Nil(t, srcs[1].Clone)
+		assert.Equal(t, configpb.WorktreePolicy_REBASE_WORKTREE_POLICY, srcs[0].WorktreePolicy)
+		assert.Nil(t, srcs[1].Refs)
+	})
+
+	t.Run("invalid branch pattern", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromUrl{
+				FromUrl: &configpb.UrlSource{Url: "https://example.com/repo.git"},
+			},
+			Refs: &configpb.RefsOptions{IncludeBranches: []string{"*/*"}},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidRefPattern)
+	})
+
 	t.Run("invalid URL", func(t *testing.T) {
 		srcs, err := Load(ctx, []*configpb.Source{{
 			Branch: &configpb.Source_FromUrl{
@@ -36,7 +90,7 @@ func TestLoadSources_StandardURL(t *testing.T) {
 					Url: "::/invalid.git",
 				},
 			},
-		}})
+		}}, nil)
 		assert.Nil(t, srcs)
 		assert.ErrorIs(t, err, errInvalidURL)
 	})
@@ -52,7 +106,7 @@ func TestLoadSources_Github(t *testing.T) {
 					Url: "https://github.com/mtth/gitfetcher",
 				},
 			},
-		}})
+		}}, nil)
 		require.NoError(t, err)
 		assert.Len(t, srcs, 1)
 		assert.Equal(t, "mtth/gitfetcher", srcs[0].FullName)
@@ -66,7 +120,7 @@ func TestLoadSources_Github(t *testing.T) {
 					Token: "abc",
 				},
 			},
-		}})
+		}}, nil)
 		assert.Nil(t, srcs)
 		assert.ErrorIs(t, err, errInvalidGithubToken)
 	})
@@ -83,7 +137,7 @@ func TestLoadSources_Github(t *testing.T) {
 					RemoteProtocol: configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL,
 				},
 			},
-		}})
+		}}, nil)
 		require.NoError(t, err)
 		assert.NotEmpty(t, srcs)
 	})
@@ -123,7 +177,7 @@ func TestGithubSourcePath(t *testing.T) {
 		"dynamic template": {
 			tpl: "{{ .Owner }}/{{ .Name }}",
 			repo: &github.Repository{
-				Owner: &github.User{Name: addr("ann")},
+				Owner: &github.User{Login: addr("ann"), Name: addr("Ann Smith")},
 				Name:  addr("bar"),
 			},
 			path: "ann/bar",
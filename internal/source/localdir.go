@@ -0,0 +1,104 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/except"
+	"github.com/mtth/gitfetcher/internal/fspath"
+	"github.com/mtth/gitfetcher/internal/target"
+)
+
+// defaultDescriptionPrefix is the start of the placeholder description created by git init.
+const defaultDescriptionPrefix = "Unnamed repository"
+
+func (c *sourceGatherer) gatherLocalDirSources(
+	_ context.Context,
+	cfg *configpb.LocalDirSource,
+) error {
+	root := cfg.GetPath()
+	targets, err := target.Find(root)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errInvalidPath, err)
+	}
+
+	pred, err := newNamePredicate(cfg.GetFilters())
+	if err != nil {
+		return err
+	}
+
+	var added, skipped int
+	for _, tgt := range targets {
+		rel, err := filepath.Rel(root, target.RootDir(tgt))
+		if err != nil {
+			return fmt.Errorf("%w: %v", errInvalidPath, err)
+		}
+		fullName := strings.TrimSuffix(filepath.ToSlash(rel), ".git")
+		if !pred.accept(fullName) {
+			skipped++
+			continue
+		}
+		c.builder.addLocalRepo(tgt.GitDir(), fullName)
+		added++
+	}
+	slog.Debug("Added local source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+func (b *sourcesBuilder) addLocalRepo(gitDir fspath.Local, fullName string) {
+	src := Source{
+		FullName:      fullName,
+		FetchURL:      (&url.URL{Scheme: "file", Path: filepath.ToSlash(gitDir)}).String(),
+		LastUpdatedAt: localRefsUpdatedAt(gitDir),
+	}
+	if data, err := os.ReadFile(filepath.Join(gitDir, "HEAD")); err == nil {
+		if ref, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: refs/heads/"); ok {
+			src.DefaultBranch = ref
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(gitDir, "description")); err == nil {
+		if desc := strings.TrimSpace(string(data)); !strings.HasPrefix(desc, defaultDescriptionPrefix) {
+			src.Description = desc
+		}
+	}
+	*b = append(*b, src)
+}
+
+// localRefsUpdatedAt returns the most recent modification time of a repository's local branches,
+// or zero if unavailable.
+func localRefsUpdatedAt(gitDir fspath.Local) time.Time {
+	var maxTime time.Time
+	visit := func(info fs.FileInfo) {
+		if t := info.ModTime(); t.After(maxTime) {
+			maxTime = t
+		}
+	}
+	if info, err := os.Stat(filepath.Join(gitDir, "packed-refs")); err == nil {
+		visit(info)
+	}
+	root := filepath.Join(gitDir, "refs", "heads")
+	err := filepath.WalkDir(root, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		visit(info)
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Failed to read local refs.", except.LogErrAttr(err), slog.String("path", gitDir))
+	}
+	return maxTime.UTC()
+}
@@ -0,0 +1,82 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates files with the given contents, relative to root.
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for fp, contents := range files {
+		fp = filepath.Join(root, filepath.FromSlash(fp))
+		require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+		require.NoError(t, os.WriteFile(fp, []byte(contents), 0644))
+	}
+}
+
+func TestLoadSources_LocalDir(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"team/app/.git/HEAD":             "ref: refs/heads/trunk\n",
+		"team/app/.git/description":      "Unnamed repository; edit this file.\n",
+		"team/app/.git/objects/.keep":    "",
+		"team/app/.git/refs/heads/trunk": "",
+		"lib.git/HEAD":                   "ref: refs/heads/main\n",
+		"lib.git/description":            "Shared library\n",
+		"lib.git/objects/.keep":          "",
+		"lib.git/refs/tags/.keep":        "",
+		"notes/README":                   "",
+	})
+	require.NoError(t, os.Chtimes(filepath.Join(root, "team/app/.git/refs/heads/trunk"), t0, t0))
+
+	t.Run("all repositories", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromLocalDir{
+				FromLocalDir: &configpb.LocalDirSource{Path: root},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []Source{{
+			FullName:      "lib",
+			Description:   "Shared library",
+			DefaultBranch: "main",
+			FetchURL:      "file://" + filepath.ToSlash(filepath.Join(root, "lib.git")),
+		}, {
+			FullName:      "team/app",
+			DefaultBranch: "trunk",
+			LastUpdatedAt: t0,
+			FetchURL:      "file://" + filepath.ToSlash(filepath.Join(root, "team/app/.git")),
+		}}, srcs)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromLocalDir{
+				FromLocalDir: &configpb.LocalDirSource{Path: root, Filters: []string{"team/*"}},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "team/app", srcs[0].FullName)
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromLocalDir{
+				FromLocalDir: &configpb.LocalDirSource{Path: filepath.Join(root, "missing")},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidPath)
+	})
+}
@@ -0,0 +1,88 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+// manifestEntry is the JSON representation of a manifest line.
+type manifestEntry struct {
+	URL           string `json:"url"`
+	Path          string `json:"path"`
+	DefaultBranch string `json:"default_branch"`
+}
+
+func (c *sourceGatherer) gatherManifestSources(
+	ctx context.Context,
+	cfg *configpb.ManifestSource,
+) error {
+	file, err := os.Open(cfg.GetPath())
+	if err != nil {
+		return fmt.Errorf("%w: %v", errInvalidManifest, err)
+	}
+	defer file.Close()
+
+	var entries []*configpb.UrlSource
+	scanner := bufio.NewScanner(file)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		entry, err := parseManifestLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%w: %s:%d: %v", errInvalidManifest, cfg.GetPath(), lineno, err)
+		}
+		if entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidManifest, err)
+	}
+
+	// Entries are gathered exactly as URL sources, which allows enriching known hosts' metadata.
+	for _, entry := range entries {
+		if err := c.gatherURLSource(ctx, entry); err != nil {
+			return err
+		}
+	}
+	slog.Debug("Added manifest source.", slog.Int("added", len(entries)))
+	return nil
+}
+
+// parseManifestLine returns the source described by a manifest line, or nil for blank lines and
+// comments.
+func parseManifestLine(line string) (*configpb.UrlSource, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+	var entry manifestEntry
+	if strings.HasPrefix(line, "{") {
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, err
+		}
+	} else {
+		fields := strings.Fields(line)
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("too many fields: %q", line)
+		}
+		fields = append(fields, "", "")
+		entry = manifestEntry{URL: fields[0], Path: fields[1], DefaultBranch: fields[2]}
+		if entry.Path == "-" {
+			entry.Path = ""
+		}
+	}
+	if entry.URL == "" {
+		return nil, fmt.Errorf("missing URL: %q", line)
+	}
+	return &configpb.UrlSource{
+		Url:           entry.URL,
+		Path:          entry.Path,
+		DefaultBranch: entry.DefaultBranch,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package source
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestLoadSources_Manifest(t *testing.T) {
+	ctx := context.Background()
+
+	writeManifest := func(t *testing.T, contents string) string {
+		fpath := filepath.Join(t.TempDir(), "repos.txt")
+		require.NoError(t, os.WriteFile(fpath, []byte(contents), 0644))
+		return fpath
+	}
+
+	t.Run("mixed lines", func(t *testing.T) {
+		fpath := writeManifest(t, `
+# Mirrors
+https://git.example.com/team/one.git
+https://git.example.com/team/two.git  mirrors/two  trunk
+https://git.example.com/team/three.git - dev
+{"url": "https://git.example.com/team/four.git", "path": "four"}
+`)
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromManifest{
+				FromManifest: &configpb.ManifestSource{Path: fpath},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 4)
+		assert.Equal(t, "team/one", srcs[0].FullName)
+		assert.Equal(t, "mirrors/two", srcs[1].RelPath)
+		assert.Equal(t, "trunk", srcs[1].DefaultBranch)
+		assert.Empty(t, srcs[2].RelPath)
+		assert.Equal(t, "dev", srcs[2].DefaultBranch)
+		assert.Equal(t, "https://git.example.com/team/four.git", srcs[3].FetchURL)
+		assert.Equal(t, "four", srcs[3].RelPath)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromManifest{
+				FromManifest: &configpb.ManifestSource{Path: filepath.Join(t.TempDir(), "missing")},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidManifest)
+	})
+
+	t.Run("invalid line", func(t *testing.T) {
+		fpath := writeManifest(t, "https://git.example.com/one.git\n{\"path\": \"foo\"}\n")
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromManifest{
+				FromManifest: &configpb.ManifestSource{Path: fpath},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errInvalidManifest)
+		assert.ErrorContains(t, err, "repos.txt:2")
+	})
+}
+
+func TestParseManifestLine(t *testing.T) {
+	for key, tc := range map[string]struct {
+		line  string
+		want  *configpb.UrlSource
+		isErr bool
+	}{
+		"blank":   {line: "  "},
+		"comment": {line: "# https://example.com/a.git"},
+		"URL":     {line: "https://example.com/a.git", want: &configpb.UrlSource{Url: "https://example.com/a.git"}},
+		"too many fields": {
+			line:  "https://example.com/a.git a main extra",
+			isErr: true,
+		},
+		"invalid JSON": {line: "{", isErr: true},
+	} {
+		t.Run(key, func(t *testing.T) {
+			got, err := parseManifestLine(tc.line)
+			if tc.isErr {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, proto.Equal(tc.want, got))
+			}
+		})
+	}
+}
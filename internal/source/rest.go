@@ -0,0 +1,102 @@
+package source
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// statusError is returned when a REST API responds with an unexpected HTTP status.
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d (%s) from %s", e.code, http.StatusText(e.code), e.url)
+}
+
+// getJSON sends a GET request to u with the provided headers and decodes the JSON response into
+// out. The response's headers are returned to support header-based pagination.
+func getJSON(
+	ctx context.Context,
+	client *http.Client,
+	u string,
+	header http.Header,
+	out any,
+) (http.Header, error) {
+	return sendJSON(ctx, client, http.MethodGet, u, header, nil, out)
+}
+
+// postJSON sends a POST request to u with a JSON-encoded body and decodes the JSON response into
+// out.
+func postJSON(
+	ctx context.Context,
+	client *http.Client,
+	u string,
+	header http.Header,
+	in, out any,
+) error {
+	_, err := sendJSON(ctx, client, http.MethodPost, u, header, in, out)
+	return err
+}
+
+func sendJSON(
+	ctx context.Context,
+	client *http.Client,
+	method, u string,
+	header http.Header,
+	in, out any,
+) (http.Header, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, vals := range header {
+		req.Header[key] = vals
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, &statusError{url: u, code: res.StatusCode}
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("unable to decode response from %s: %w", u, err)
+	}
+	return res.Header, nil
+}
+
+// getText sends a GET request to u and returns the response's body.
+func getText(ctx context.Context, client *http.Client, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, &statusError{url: u, code: res.StatusCode}
+	}
+	return io.ReadAll(res.Body)
+}
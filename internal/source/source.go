@@ -2,19 +2,27 @@ package source
 
 import (
 	"cmp"
+	"context"
+	"fmt"
 	"net/url"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/go-github/v66/github"
 	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
 	"github.com/mtth/gitfetcher/internal/fspath"
+	"github.com/mtth/gitfetcher/internal/target"
 )
 
 // Source captures information about a repository to be mirrored.
 type Source struct {
 	// Qualified repository name, typically $owner/$name. Non-empty.
 	FullName string
+	// Stable identifier, which is preserved when the repository is renamed or transferred. May be
+	// empty.
+	ID string
 	// Optional human-readable description. May be empty.
 	Description string
 	// Default branch. May be empty.
@@ -27,15 +35,140 @@ type Source struct {
 	FetchURL string
 	// Git flags used to fetch repository updates.
 	FetchFlags []string
+	// Maximum duration of each git command when syncing. Zero if unset.
+	FetchTimeout time.Duration
+	// Partial and shallow clone settings. Nil if unset.
+	Clone *CloneSettings
+	// Refs fetched from the remote. Nil for git's defaults.
+	Refs *RefSettings
+	// Update strategy for non-bare repositories' worktrees.
+	WorktreePolicy configpb.WorktreePolicy
+	// Optional provider of short-lived git flags (e.g. expiring credentials), evaluated before each
+	// fetch. May be nil.
+	fetchCredentials func(context.Context) ([]string, error)
+}
+
+// CloneSettings restricts the objects downloaded when fetching a repository.
+type CloneSettings struct {
+	// Partial clone filter specification, for example blob:none. Empty for full clones.
+	Filter string
+	// Number of commits fetched from the tip of each branch when the repository is created. Zero
+	// for unlimited.
+	Depth int
+}
+
+// NewCloneSettings returns settings matching the configuration, or nil if it is nil.
+func NewCloneSettings(cfg *configpb.CloneOptions) *CloneSettings {
+	if cfg == nil {
+		return nil
+	}
+	settings := &CloneSettings{Depth: int(cfg.GetDepth())}
+	switch cfg.GetFilter() {
+	case configpb.CloneOptions_NO_FILTER:
+	case configpb.CloneOptions_BLOBLESS_FILTER:
+		settings.Filter = "blob:none"
+	case configpb.CloneOptions_TREELESS_FILTER:
+		settings.Filter = "tree:0"
+	}
+	return settings
+}
+
+// RefSettings selects the refs fetched from a repository's remote.
+type RefSettings struct {
+	// Fetch refspecs, including negative ones. Non-empty.
+	Refspecs []string
+	// Value of the remote's tagOpt configuration, either --tags or --no-tags. Empty for git's
+	// default.
+	TagOpt string
+}
+
+// DefaultRefSettings returns the settings git uses when adding a remote: all branches, along with
+// tags pointing into them.
+func DefaultRefSettings() *RefSettings {
+	return &RefSettings{Refspecs: []string{branchRefspec("*")}}
+}
+
+// NewRefSettings returns settings matching the configuration, or nil if it is nil.
+func NewRefSettings(cfg *configpb.RefsOptions) (*RefSettings, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	settings := &RefSettings{}
+	includes := cfg.GetIncludeBranches()
+	if len(includes) == 0 {
+		includes = []string{"*"}
+	}
+	for _, pat := range includes {
+		if err := validateRefPattern(pat); err != nil {
+			return nil, err
+		}
+		settings.Refspecs = append(settings.Refspecs, branchRefspec(pat))
+	}
+	for _, pat := range cfg.GetExcludeBranches() {
+		if err := validateRefPattern(pat); err != nil {
+			return nil, err
+		}
+		settings.Refspecs = append(settings.Refspecs, "^refs/heads/"+pat)
+	}
+	if cfg.GetPullRequests() {
+		settings.Refspecs = append(settings.Refspecs, remoteRefspec("refs/pull/*/head", "pull/*"))
+	}
+	if cfg.GetMergeRequests() {
+		settings.Refspecs = append(
+			settings.Refspecs,
+			remoteRefspec("refs/merge-requests/*/head", "merge-requests/*"),
+		)
+	}
+	switch cfg.GetTags() {
+	case configpb.RefsOptions_DEFAULT_TAGS:
+	case configpb.RefsOptions_ALL_TAGS:
+		settings.TagOpt = "--tags"
+	case configpb.RefsOptions_NO_TAGS:
+		settings.TagOpt = "--no-tags"
+	}
+	return settings, nil
+}
+
+func branchRefspec(pat string) string {
+	return remoteRefspec("refs/heads/"+pat, pat)
+}
+
+// remoteRefspec returns a forced refspec storing remote refs matching src under the default
+// remote's namespace.
+func remoteRefspec(src, dst string) string {
+	return fmt.Sprintf("+%s:refs/remotes/%s/%s", src, target.DefaultRemote, dst)
+}
+
+// validateRefPattern checks that a branch pattern can be used in a refspec, which only supports a
+// single wildcard.
+func validateRefPattern(pat string) error {
+	if pat == "" || strings.Count(pat, "*") > 1 || strings.ContainsAny(pat, " :^?[\\~") {
+		return fmt.Errorf("%w: %q", errInvalidRefPattern, pat)
+	}
+	return nil
+}
+
+// ResolveFetchFlags returns all git flags used to fetch repository updates, including any
+// short-lived credentials.
+func (s *Source) ResolveFetchFlags(ctx context.Context) ([]string, error) {
+	if s.fetchCredentials == nil {
+		return s.FetchFlags, nil
+	}
+	flags, err := s.fetchCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(s.FetchFlags, flags), nil
 }
 
 type sourcesBuilder []Source
 
 type sourceOptions struct {
-	defaultBranch  string
-	path           fspath.POSIX
-	fetchFlags     []string
-	remoteProtocol configpb.RemoteProtocol
+	defaultBranch    string
+	path             fspath.POSIX
+	fetchFlags       []string
+	fetchCredentials func(context.Context) ([]string, error)
+	remoteProtocol   configpb.RemoteProtocol
 }
 
 func (b *sourcesBuilder) addStandardURLRepo(u *url.URL, opts sourceOptions) {
@@ -51,11 +184,14 @@ func (b *sourcesBuilder) addStandardURLRepo(u *url.URL, opts sourceOptions) {
 func (b *sourcesBuilder) addGithubRepo(repo *github.Repository, opts sourceOptions) {
 	src := Source{
 		FullName:      repo.GetFullName(),
+		ID:            githubSourceID(repo),
 		Description:   repo.GetDescription(),
 		DefaultBranch: cmp.Or(opts.defaultBranch, repo.GetDefaultBranch()),
 		LastUpdatedAt: repo.GetUpdatedAt().Time,
 		RelPath:       opts.path,
 		FetchFlags:    opts.fetchFlags,
+
+		fetchCredentials: opts.fetchCredentials,
 	}
 	switch opts.remoteProtocol {
 	case configpb.RemoteProtocol_DEFAULT_REMOTE_PROTOCOL:
@@ -66,6 +202,32 @@ func (b *sourcesBuilder) addGithubRepo(repo *github.Repository, opts sourceOptio
 	*b = append(*b, src)
 }
 
+// applyCommonOptions sets options shared by all sources of a configuration on the sources added
+// since index start.
+func (b *sourcesBuilder) applyCommonOptions(start int, cfg *configpb.Source) error {
+	refs, err := NewRefSettings(cfg.GetRefs())
+	if err != nil {
+		return err
+	}
+	for i := start; i < len(*b); i++ {
+		(*b)[i].FetchTimeout = cfg.GetFetchTimeout().AsDuration()
+		(*b)[i].Clone = NewCloneSettings(cfg.GetClone())
+		(*b)[i].Refs = refs
+		(*b)[i].WorktreePolicy = cfg.GetWorktreePolicy()
+	}
+	return nil
+}
+
+// githubSourceID returns a repository's stable ID. Repository IDs are only unique within a GitHub
+// instance, so we qualify them with its host.
+func githubSourceID(repo *github.Repository) string {
+	htmlURL, err := url.Parse(repo.GetHTMLURL())
+	if repo.GetID() == 0 || err != nil || htmlURL.Host == "" {
+		return ""
+	}
+	return "github:" + htmlURL.Hostname() + ":" + strconv.FormatInt(repo.GetID(), 10)
+}
+
 func (b *sourcesBuilder) build() []Source {
 	return ([]Source)(*b)
 }
@@ -73,3 +235,19 @@ func (b *sourcesBuilder) build() []Source {
 func fullNameFromURL(u *url.URL) string {
 	return strings.TrimPrefix(strings.TrimSuffix(u.Path, ".git"), "/")
 }
+
+// parseRemoteURL parses a git remote URL. Scp-like SSH URLs (for example
+// git@git.example.com:team/repo.git), which url.Parse rejects, are converted to their ssh://
+// equivalent.
+func parseRemoteURL(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		if host, path, ok := strings.Cut(rawURL, ":"); ok && !strings.Contains(host, "/") {
+			u := &url.URL{Scheme: "ssh", Host: host, Path: "/" + path}
+			if user, hostname, found := strings.Cut(host, "@"); found {
+				u.User, u.Host = url.User(user), hostname
+			}
+			return u, nil
+		}
+	}
+	return url.Parse(rawURL)
+}
@@ -0,0 +1,160 @@
+package source
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+)
+
+const (
+	defaultSourcehutURL = "https://git.sr.ht"
+
+	sourcehutReposFragment = `
+fragment repos on RepositoryCursor {
+  results { name description updated owner { canonicalName } HEAD { name } }
+  cursor
+}`
+	sourcehutOwnReposQuery = `
+query($cursor: Cursor) {
+  me { repositories(cursor: $cursor) { ...repos } }
+}` + sourcehutReposFragment
+	sourcehutUserReposQuery = `
+query($user: String!, $cursor: Cursor) {
+  user(username: $user) { repositories(cursor: $cursor) { ...repos } }
+}` + sourcehutReposFragment
+)
+
+// sourcehutRepo contains the subset of git.sr.ht's GraphQL repository representation used to
+// create sources. See https://man.sr.ht/git.sr.ht/graphql.md.
+type sourcehutRepo struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Updated     time.Time `json:"updated"`
+	Owner       struct {
+		CanonicalName string `json:"canonicalName"`
+	} `json:"owner"`
+	Head *struct {
+		Name string `json:"name"`
+	} `json:"HEAD"`
+}
+
+type sourcehutReposPage struct {
+	Repositories struct {
+		Results []sourcehutRepo `json:"results"`
+		Cursor  *string         `json:"cursor"`
+	} `json:"repositories"`
+}
+
+type sourcehutResponse struct {
+	Data struct {
+		Me   *sourcehutReposPage `json:"me"`
+		User *sourcehutReposPage `json:"user"`
+	} `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+func (c *sourceGatherer) gatherSourcehutSources(
+	ctx context.Context,
+	cfg *configpb.SourcehutSource,
+) error {
+	rawURL := cmp.Or(cfg.GetBaseUrl(), defaultSourcehutURL)
+	baseURL, err := url.Parse(strings.TrimSuffix(rawURL, "/"))
+	if err != nil || baseURL.Host == "" {
+		return fmt.Errorf("%w: %s", errInvalidURL, rawURL)
+	}
+	queryURL := baseURL.JoinPath("query").String()
+	header := http.Header{"Authorization": {"Bearer " + expandToken(cfg.GetToken())}}
+
+	query := sourcehutOwnReposQuery
+	variables := map[string]any{}
+	if user := cfg.GetUser(); user != "" {
+		query = sourcehutUserReposQuery
+		variables["user"] = user
+	}
+
+	pred, err := newNamePredicate(cfg.GetFilters())
+	if err != nil {
+		return err
+	}
+
+	var added, skipped int
+	for {
+		var res sourcehutResponse
+		body := map[string]any{"query": query, "variables": variables}
+		if err := postJSON(ctx, c.httpClient, queryURL, header, body, &res); err != nil {
+			return fmt.Errorf("%w: %w", errSourcehutListFailed, err)
+		}
+		if len(res.Errors) > 0 {
+			return fmt.Errorf("%w: %s", errSourcehutListFailed, res.Errors[0].Message)
+		}
+		page := cmp.Or(res.Data.Me, res.Data.User)
+		if page == nil {
+			return fmt.Errorf("%w: missing user %q", errSourcehutListFailed, cfg.GetUser())
+		}
+		for _, repo := range page.Repositories.Results {
+			owner := strings.TrimPrefix(repo.Owner.CanonicalName, "~")
+			fullName := owner + "/" + repo.Name
+			if !pred.accept(fullName) {
+				skipped++
+				continue
+			}
+
+			path, err := templateSourcePath(cfg.GetPathTemplate(), fullName, repo.Name, owner)
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidPath, err)
+			}
+
+			c.builder.addSourcehutRepo(&repo, baseURL, sourceOptions{
+				remoteProtocol: cfg.GetRemoteProtocol(),
+				path:           path,
+			})
+			added++
+		}
+		cursor := page.Repositories.Cursor
+		if cursor == nil {
+			break
+		}
+		variables["cursor"] = *cursor
+	}
+	slog.Debug("Added SourceHut source.", slog.Int("added", added), slog.Int("skipped", skipped))
+	return nil
+}
+
+func (b *sourcesBuilder) addSourcehutRepo(
+	repo *sourcehutRepo,
+	baseURL *url.URL,
+	opts sourceOptions,
+) {
+	owner := strings.TrimPrefix(repo.Owner.CanonicalName, "~")
+	src := Source{
+		FullName:      owner + "/" + repo.Name,
+		Description:   repo.Description,
+		DefaultBranch: opts.defaultBranch,
+		LastUpdatedAt: repo.Updated,
+		RelPath:       opts.path,
+	}
+	if src.DefaultBranch == "" && repo.Head != nil {
+		src.DefaultBranch = strings.TrimPrefix(repo.Head.Name, "refs/heads/")
+	}
+	switch opts.remoteProtocol {
+	case configpb.RemoteProtocol_DEFAULT_REMOTE_PROTOCOL:
+		src.FetchURL = baseURL.JoinPath(repo.Owner.CanonicalName, repo.Name).String()
+	case configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL:
+		src.FetchURL = fmt.Sprintf(
+			"git@%s:%s/%s",
+			baseURL.Hostname(),
+			repo.Owner.CanonicalName,
+			repo.Name,
+		)
+	}
+	*b = append(*b, src)
+}
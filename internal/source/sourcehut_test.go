@@ -0,0 +1,112 @@
+package source
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSources_Sourcehut(t *testing.T) {
+	ctx := context.Background()
+	t0 := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+
+	repo := func(owner, name string) map[string]any {
+		return map[string]any{
+			"name":        name,
+			"description": "About " + name,
+			"updated":     t0.Format(time.RFC3339),
+			"owner":       map[string]any{"canonicalName": "~" + owner},
+			"HEAD":        map[string]any{"name": "refs/heads/trunk"},
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/query" || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body struct {
+			Variables map[string]string `json:"variables"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		var data map[string]any
+		switch user, cursor := body.Variables["user"], body.Variables["cursor"]; {
+		case user == "" && cursor == "":
+			data = map[string]any{"me": map[string]any{"repositories": map[string]any{
+				"results": []map[string]any{repo("ann", "one")},
+				"cursor":  "next",
+			}}}
+		case user == "" && cursor == "next":
+			data = map[string]any{"me": map[string]any{"repositories": map[string]any{
+				"results": []map[string]any{repo("ann", "two")},
+			}}}
+		case user == "bob":
+			data = map[string]any{"user": map[string]any{"repositories": map[string]any{
+				"results": []map[string]any{repo("bob", "tool")},
+			}}}
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"errors": []map[string]any{{"message": "no such user"}},
+			})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	defer server.Close()
+
+	t.Run("token owner", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromSourcehut{
+				FromSourcehut: &configpb.SourcehutSource{Token: "secret", BaseUrl: server.URL},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 2)
+		assert.Equal(t, Source{
+			FullName:      "ann/one",
+			Description:   "About one",
+			DefaultBranch: "trunk",
+			LastUpdatedAt: t0,
+			FetchURL:      server.URL + "/~ann/one",
+		}, srcs[0])
+		assert.Equal(t, "ann/two", srcs[1].FullName)
+	})
+
+	t.Run("named user over SSH", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromSourcehut{
+				FromSourcehut: &configpb.SourcehutSource{
+					Token:          "secret",
+					User:           "bob",
+					BaseUrl:        server.URL,
+					RemoteProtocol: configpb.RemoteProtocol_SSH_REMOTE_PROTOCOL,
+				},
+			},
+		}}, nil)
+		require.NoError(t, err)
+		require.Len(t, srcs, 1)
+		assert.Equal(t, "git@127.0.0.1:~bob/tool", srcs[0].FetchURL)
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		srcs, err := Load(ctx, []*configpb.Source{{
+			Branch: &configpb.Source_FromSourcehut{
+				FromSourcehut: &configpb.SourcehutSource{
+					Token:   "secret",
+					User:    "missing",
+					BaseUrl: server.URL,
+				},
+			},
+		}}, nil)
+		assert.Nil(t, srcs)
+		assert.ErrorIs(t, err, errSourcehutListFailed)
+		assert.ErrorContains(t, err, "no such user")
+	})
+}
@@ -14,20 +14,27 @@ import (
 	"path"
 	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
 	"github.com/mtth/gitfetcher/internal/fspath"
+	"github.com/mtth/gitfetcher/internal/retry"
 	"github.com/mtth/gitfetcher/internal/source"
 	"github.com/mtth/gitfetcher/internal/target"
+	"golang.org/x/sync/errgroup"
 )
 
 var errDuplicateSource = errors.New("duplicate source path")
 
 // Reexports.
 var (
-	FindTargets = target.Find
-	LoadSources = source.Load
+	FindTargets      = target.Find
+	LoadSources      = source.Load
+	NewRetryPolicy   = retry.NewPolicy
+	NewCloneSettings = source.NewCloneSettings
 )
 
 // Syncable contains all the information needed to mirror a repository.
@@ -38,8 +45,11 @@ type Syncable struct {
 	target *target.Target
 	// Mirror source, if any. Present if target is nil.
 	source *source.Source
-	// True iff the repository should be created bare.
-	bareInit bool
+	// Layout used if the repository is created.
+	initLayout configpb.Options_Layout
+	// Previous gitdir of the target, if it must be moved to GitDir. This happens when the source
+	// was renamed or transferred.
+	relocateFrom fspath.Local
 }
 
 // LastSyncedAt returns the time at which the repo's origin remote was last updated, or zero if the
@@ -66,7 +76,7 @@ func GatherSyncables(
 		fp := source.RelPath
 		if fp == "" {
 			fp = source.FullName
-			if initLayout == configpb.Options_BARE_LAYOUT {
+			if initLayout != configpb.Options_DEFAULT_LAYOUT {
 				fp += ".git"
 			} else {
 				fp = path.Join(fp, target.GitDirName)
@@ -79,22 +89,36 @@ func GatherSyncables(
 		sourcesByPath[fp] = &source
 	}
 
-	// Then we iterate over targets to create syncables, adding a source if available.
+	// Then we iterate over targets to create syncables, adding a source if available. Targets
+	// without a source are indexed by source ID, to detect renamed sources below.
 	syncablesByPath := make(map[string]Syncable)
+	orphansByID := make(map[string]*target.Target)
 	for _, target := range targets {
 		gitDir := target.GitDir()
 		syncable := Syncable{GitDir: gitDir, target: &target}
 		if source, ok := sourcesByPath[gitDir]; ok {
 			syncable.source = source
+		} else if id := readSourceID(gitDir); id != "" {
+			orphansByID[id] = &target
 		}
 		syncablesByPath[gitDir] = syncable
 	}
-	// Finally, we look for sources which do not yet have a target.
-	bareInit := initLayout == configpb.Options_BARE_LAYOUT
+	// Finally, we look for sources which do not yet have a target. If one of the orphaned targets
+	// was synced from the same source, we move it rather than creating a new one.
 	for fp, source := range sourcesByPath {
-		if _, ok := syncablesByPath[fp]; !ok {
-			syncablesByPath[fp] = Syncable{GitDir: fp, source: source, bareInit: bareInit}
+		if _, ok := syncablesByPath[fp]; ok {
+			continue
 		}
+		tgt, ok := orphansByID[source.ID]
+		if ok && source.ID != "" && canRelocate(*tgt, fp, source.FetchURL) {
+			from := (*tgt).GitDir()
+			slog.Info("Found renamed source.", slog.String("from", from), slog.String("to", fp))
+			delete(syncablesByPath, from)
+			delete(orphansByID, source.ID)
+			syncablesByPath[fp] = Syncable{GitDir: fp, target: tgt, source: source, relocateFrom: from}
+			continue
+		}
+		syncablesByPath[fp] = Syncable{GitDir: fp, source: source, initLayout: initLayout}
 	}
 
 	slog.Info(fmt.Sprintf("Gathered %v syncables.", len(syncablesByPath)))
@@ -108,7 +132,9 @@ func (s *Syncable) SyncStatus() SyncStatus {
 	switch {
 	case s.target == nil:
 		return SyncStatusMissing
-	case s.source == nil || s.source.LastUpdatedAt.IsZero():
+	case s.source == nil:
+		return SyncStatusOrphaned
+	case s.source.LastUpdatedAt.IsZero():
 		return SyncStatusUnknown
 	case (*s.target).RemoteLastUpdatedAt().Before(s.source.LastUpdatedAt):
 		return SyncStatusStale
@@ -130,45 +156,155 @@ const (
 	SyncStatusStale
 	// The local copy of the repository exists and is up-to-date.
 	SyncStatusFresh
+	// A local copy of the repository exists but no source matches it.
+	SyncStatusOrphaned
 )
 
-var errSyncFailed = errors.New("sync failed")
+var (
+	errSyncFailed      = errors.New("sync failed")
+	errCommandTimedOut = errors.New("command timed out")
+)
+
+// SyncError describes a repository which failed to sync. It matches errSyncFailed.
+type SyncError struct {
+	// Absolute local path to the repository's gitdir.
+	GitDir fspath.Local
+	// Step which failed, for example the git command which was run.
+	Step string
+	// Underlying error.
+	Err error
+}
+
+func (e *SyncError) Error() string {
+	return fmt.Sprintf("%v: %s: %s: %v", errSyncFailed, e.GitDir, e.Step, e.Err)
+}
+
+func (e *SyncError) Unwrap() []error {
+	return []error{errSyncFailed, e.Err}
+}
 
-func checkSyncStep(err error) {
+func checkSyncStep(step string, err error) {
 	if err != nil {
-		panic(fmt.Errorf("%w: %v", errSyncFailed, err))
+		panic(&SyncError{Step: step, Err: err})
 	}
 }
 
-// Sync syncs local copies in the root folder of each source. Missing local repositories will be
-// created, others will be updated as needed.
-func (s *Syncable) Sync(ctx context.Context) (err error) {
-	slog.Debug(fmt.Sprintf("Syncing %+v...", s))
-
+// catchSyncStep runs fn, returning any step failure as error rather than panicking.
+func catchSyncStep(fn func()) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			if rerr, ok := r.(error); ok && errors.Is(rerr, errSyncFailed) {
-				err = errors.Join(err, rerr)
+			if serr, ok := r.(*SyncError); ok {
+				err = serr
 				return
 			}
 			panic(r)
 		}
 	}()
+	fn()
+	return nil
+}
+
+// SyncOptions configures SyncAll.
+type SyncOptions struct {
+	// Maximum number of repositories synced concurrently. Values lower than 1 are treated as 1.
+	Jobs int
+	// Stop at the first failure instead of syncing the remaining repositories.
+	FailFast bool
+	// Retries of fetches which fail transiently.
+	Retry retry.Policy
+	// Maximum duration of each git command, unless overridden by the source. Zero means no limit.
+	FetchTimeout time.Duration
+	// Partial and shallow clone settings, unless overridden by the source. Nil for full clones.
+	Clone *source.CloneSettings
+	// Backups of refs rewritten or deleted upstream. Nil to disable them.
+	History *HistorySettings
+
+	// Performs the sync's side effects, defaults to running them. Swapped out when planning.
+	executor executor
+}
+
+func (o SyncOptions) exec() executor {
+	if o.executor == nil {
+		return systemExecutor{}
+	}
+	return o.executor
+}
+
+// SyncAll syncs all syncables concurrently. By default, repositories which fail to sync do not
+// prevent others from syncing and are returned sorted by gitdir. When FailFast is set, the first
+// failure instead cancels all in-flight syncs and is returned as error.
+func SyncAll(ctx context.Context, syncables []Syncable, opts SyncOptions) ([]*SyncError, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var g errgroup.Group
+	g.SetLimit(max(opts.Jobs, 1))
+	var mu sync.Mutex
+	var failures []*SyncError
+	for i := range syncables {
+		syncable := &syncables[i]
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			err := syncable.sync(ctx, opts)
+			var serr *SyncError
+			if err == nil || opts.FailFast || ctx.Err() != nil || !errors.As(err, &serr) {
+				if err != nil {
+					cancel()
+				}
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			failures = append(failures, serr)
+			return nil
+		})
+	}
+	err := g.Wait()
+	slices.SortFunc(failures, func(e1, e2 *SyncError) int { return cmp.Compare(e1.GitDir, e2.GitDir) })
+	return failures, err
+}
+
+// Sync syncs local copies in the root folder of each source. Missing local repositories will be
+// created, others will be updated as needed. Failed fetches are not retried, see SyncAll.
+func (s *Syncable) Sync(ctx context.Context) error {
+	return s.sync(ctx, SyncOptions{})
+}
+
+func (s *Syncable) sync(ctx context.Context, opts SyncOptions) error {
+	s.logger().Debug(fmt.Sprintf("Syncing %+v...", s))
 
 	status := s.SyncStatus()
+	err := catchSyncStep(func() { s.syncSteps(ctx, opts, status) })
+	if err != nil {
+		var serr *SyncError
+		if errors.As(err, &serr) {
+			serr.GitDir = s.GitDir
+		}
+		return err
+	}
+	s.logger().Info(fmt.Sprintf("Synced %+v.", s), slog.String("status", status.String()))
+	return nil
+}
+
+func (s *Syncable) syncSteps(ctx context.Context, opts SyncOptions, status SyncStatus) {
+	if s.relocateFrom != "" {
+		s.relocateTarget(ctx, opts)
+	}
 	if status == SyncStatusMissing {
-		s.createTarget(ctx)
+		s.createTarget(ctx, opts)
+	} else {
+		s.reconcileRefs(ctx, opts)
 	}
-	s.updateMetadata(ctx)
+	s.updateMetadata(ctx, opts)
 	if status != SyncStatusFresh {
-		s.updateContents(ctx)
+		s.updateContents(ctx, opts)
 	}
-	slog.Info(fmt.Sprintf("Synced %+v.", s), slog.String("status", status.String()))
-	return
 }
 
-func (s *Syncable) createTarget(ctx context.Context) {
-	checkSyncStep(os.MkdirAll(s.GitDir, 0755))
+func (s *Syncable) createTarget(ctx context.Context, opts SyncOptions) {
+	checkSyncStep("create gitdir", opts.exec().mkdirAll(s.GitDir))
 
 	// We don't use git clone to avoid having the credentials saved in the repo's config and share
 	// more logic with the update function below.
@@ -176,15 +312,159 @@ func (s *Syncable) createTarget(ctx context.Context) {
 	if branch := s.source.DefaultBranch; branch != "" {
 		initArgs = append(initArgs, "-b", branch)
 	}
-	if s.bareInit {
+	if s.isBare() {
 		initArgs = append(initArgs, "--bare")
+		s.runGit(ctx, opts, initArgs...)
+	} else {
+		// Running git init from inside the gitdir would create a nested one.
+		s.runWorktreeGit(ctx, opts, initArgs...)
 	}
-	runGitCommand(ctx, s.GitDir, initArgs)
 
 	// TODO: Confirm that we do not need -m to specify a branch when adding the remote.
-	runGitCommand(ctx, s.GitDir, []string{"remote", "add", target.DefaultRemote, s.source.FetchURL})
+	if s.isMirror() {
+		// This matches the configuration written by git clone --mirror.
+		s.runGit(ctx, opts, "remote", "add", "--mirror=fetch", target.DefaultRemote, s.source.FetchURL)
+		s.runGit(ctx, opts, "config", "set", "remote."+target.DefaultRemote+".mirror", "true")
+		// Backups of rewritten refs are local only, we hide them from clones of the mirror.
+		s.runGit(ctx, opts, "config", "set", "uploadpack.hideRefs", historyRefPrefix)
+		s.writeRefs(ctx, opts, &source.RefSettings{Refspecs: []string{mirrorRefspec}})
+	} else {
+		s.runGit(ctx, opts, "remote", "add", target.DefaultRemote, s.source.FetchURL)
+		s.writeRefs(ctx, opts, source.DefaultRefSettings())
+	}
+
+	s.logger().Debug("Created target.")
+}
+
+// mirrorRefspec is the refspec of mirror repositories, which fetch all refs as is.
+const mirrorRefspec = "+refs/*:refs/*"
+
+// mirrorRefSettings returns the settings of mirror repositories. Backups of rewritten refs are
+// excluded, otherwise fetches would prune them.
+func mirrorRefSettings() *source.RefSettings {
+	return &source.RefSettings{Refspecs: []string{mirrorRefspec, "^" + historyRefPrefix + "*"}}
+}
 
-	slog.Debug("Created target.")
+// reconcileRefs updates the target's remote configuration to fetch the source's refs, for example
+// after its refs settings were changed. Targets without remote are left as is.
+func (s *Syncable) reconcileRefs(ctx context.Context, opts SyncOptions) {
+	if s.source == nil {
+		return
+	}
+	cfg, err := target.ReadConfig(s.currentGitDir())
+	checkSyncStep("read config", err)
+	prefix := "remote." + target.DefaultRemote + "."
+	if cfg.Get(prefix+"url") == "" {
+		return
+	}
+	s.writeRefs(ctx, opts, &source.RefSettings{
+		Refspecs: cfg.GetAll(prefix + "fetch"),
+		TagOpt:   cfg.Get(prefix + "tagOpt"),
+	})
+}
+
+// writeRefs updates the parts of the target's remote configuration which differ from its source's
+// refs settings, given their current values.
+func (s *Syncable) writeRefs(ctx context.Context, opts SyncOptions, current *source.RefSettings) {
+	want := s.source.Refs
+	if s.isMirror() {
+		want = mirrorRefSettings()
+	} else if want == nil {
+		want = source.DefaultRefSettings()
+	}
+	prefix := "remote." + target.DefaultRemote + "."
+	if !slices.Equal(current.Refspecs, want.Refspecs) {
+		if len(current.Refspecs) > 0 {
+			s.runGit(ctx, opts, "config", "unset", "--all", prefix+"fetch")
+		}
+		for _, refspec := range want.Refspecs {
+			s.runGit(ctx, opts, "config", "set", "--append", prefix+"fetch", refspec)
+		}
+	}
+	if current.TagOpt != want.TagOpt {
+		if want.TagOpt == "" {
+			s.runGit(ctx, opts, "config", "unset", prefix+"tagOpt")
+		} else {
+			// The separator prevents the value from being parsed as an option.
+			s.runGit(ctx, opts, "config", "set", "--", prefix+"tagOpt", want.TagOpt)
+		}
+	}
+}
+
+// cloneSettings returns the applicable partial and shallow clone settings, or nil for full clones.
+func (s *Syncable) cloneSettings(opts SyncOptions) *source.CloneSettings {
+	if src := s.source; src != nil && src.Clone != nil {
+		return src.Clone
+	}
+	return opts.Clone
+}
+
+// relocateTarget moves the target's directory to match its source's new path, and points its remote
+// to the source's new URL.
+func (s *Syncable) relocateTarget(ctx context.Context, opts SyncOptions) {
+	from, to := s.relocateFrom, s.GitDir
+	if !s.isBare() {
+		from, to = filepath.Dir(from), filepath.Dir(to)
+	}
+	checkSyncStep("create parent", opts.exec().mkdirAll(filepath.Dir(to)))
+	checkSyncStep("move target", opts.exec().rename(from, to))
+	// Later steps read the target, which must point to its new location. When planning, the target
+	// is not moved and stays valid.
+	if tgt, err := target.FromPath(to); err == nil && tgt != nil {
+		s.target = &tgt
+	}
+	s.runGit(ctx, opts, "remote", "set-url", target.DefaultRemote, s.source.FetchURL)
+	s.logger().Info("Relocated target.", slog.String("from", from))
+}
+
+// runGit runs a git command in the syncable's gitdir, bounded by the applicable timeout.
+func (s *Syncable) runGit(ctx context.Context, opts SyncOptions, args ...string) {
+	ctx, cancel := s.gitContext(ctx, opts)
+	defer cancel()
+	opts.exec().runGit(ctx, s.GitDir, args)
+}
+
+// runWorktreeGit runs a git command in the syncable's working directory, bounded by the applicable
+// timeout. Commands which operate on the worktree fail when run from the gitdir.
+func (s *Syncable) runWorktreeGit(ctx context.Context, opts SyncOptions, args ...string) {
+	ctx, cancel := s.gitContext(ctx, opts)
+	defer cancel()
+	opts.exec().runGit(ctx, s.WorkDir(), args)
+}
+
+// readGit runs a git command without side effects in the syncable's working directory, bounded by
+// the applicable timeout, and returns its output. Unlike other commands, it also runs when
+// planning.
+func (s *Syncable) readGit(ctx context.Context, opts SyncOptions, args ...string) string {
+	ctx, cancel := s.gitContext(ctx, opts)
+	defer cancel()
+	cwd := s.currentGitDir()
+	if !s.isBare() {
+		cwd = filepath.Dir(cwd)
+	}
+	return readGitCommand(ctx, cwd, args)
+}
+
+// gitContext returns a context bounded by the timeout applicable to the syncable's git commands.
+func (s *Syncable) gitContext(
+	ctx context.Context,
+	opts SyncOptions,
+) (context.Context, context.CancelFunc) {
+	timeout := opts.FetchTimeout
+	if src := s.source; src != nil && src.FetchTimeout > 0 {
+		timeout = src.FetchTimeout
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	cause := fmt.Errorf("%w after %v", errCommandTimedOut, timeout)
+	return context.WithTimeoutCause(ctx, timeout, cause)
+}
+
+// logger returns a logger which attributes records to this syncable, since syncs may run
+// concurrently.
+func (s *Syncable) logger() *slog.Logger {
+	return slog.With(slog.String("gitdir", s.GitDir))
 }
 
 func (s *Syncable) defaultRemoteRef() string {
@@ -198,13 +478,46 @@ func (s *Syncable) isBare() bool {
 	if tgt := s.target; tgt != nil {
 		return target.IsBare(*tgt)
 	}
-	return s.bareInit
+	return s.initLayout != configpb.Options_DEFAULT_LAYOUT
+}
+
+func (s *Syncable) isMirror() bool {
+	if tgt := s.target; tgt != nil {
+		return target.IsMirror(*tgt)
+	}
+	return s.initLayout == configpb.Options_MIRROR_LAYOUT
 }
 
 func (s *Syncable) gitPath(lp fspath.POSIX) fspath.Local {
 	return filepath.Join(s.GitDir, filepath.FromSlash(lp))
 }
 
+// currentGitDir returns the gitdir which the repository's current state is read from. It differs
+// from GitDir when planning a relocation, since the target is then not moved.
+func (s *Syncable) currentGitDir() fspath.Local {
+	if tgt := s.target; tgt != nil {
+		return (*tgt).GitDir()
+	}
+	return s.GitDir
+}
+
+// currentGitPath is analogous to gitPath, within the current gitdir.
+func (s *Syncable) currentGitPath(lp fspath.POSIX) fspath.Local {
+	return filepath.Join(s.currentGitDir(), filepath.FromSlash(lp))
+}
+
+// Layout returns a short description of the syncable's repository layout: "mirror", "bare", or
+// "default".
+func (s *Syncable) Layout() string {
+	if s.isMirror() {
+		return "mirror"
+	}
+	if s.isBare() {
+		return "bare"
+	}
+	return "default"
+}
+
 // WorkDir returns the syncable's working directory, or an empty string if absent (for bare repos).
 func (s *Syncable) WorkDir() fspath.Local {
 	if s.isBare() {
@@ -218,67 +531,234 @@ func (s *Syncable) RootDir() fspath.Local {
 	return cmp.Or(s.WorkDir(), s.GitDir)
 }
 
-func (s *Syncable) updateContents(ctx context.Context) {
-	slog.Debug("Updating contents...")
+func (s *Syncable) updateContents(ctx context.Context, opts SyncOptions) {
+	s.logger().Debug("Updating contents...")
 
 	fetchFlags := []string{"fetch", "--all"}
+	if s.isMirror() {
+		// Mirrors must not retain refs which were deleted upstream.
+		fetchFlags = append(fetchFlags, "--prune")
+	}
+	if clone := s.cloneSettings(opts); clone != nil {
+		if clone.Filter != "" {
+			// Persisting the filter on the remote applies it to this and all later fetches, including
+			// the ones git runs to download missing objects on demand.
+			s.runGit(ctx, opts, "config", "set", "remote."+target.DefaultRemote+".promisor", "true")
+			s.runGit(ctx, opts,
+				"config", "set", "remote."+target.DefaultRemote+".partialclonefilter", clone.Filter)
+		}
+		if clone.Depth > 0 && s.target == nil {
+			fetchFlags = append(fetchFlags, "--depth", strconv.Itoa(clone.Depth))
+		}
+	}
+	if s.target != nil && fileExists(s.currentGitPath("shallow")) {
+		// Deepening existing shallow repositories on each fetch would disconnect their previous tips
+		// from the new ones, preventing fast-forwards. Instead we fetch all new commits, accepting
+		// refs which require updating the shallow boundary (for example after a force-push).
+		fetchFlags = append(fetchFlags, "--update-shallow")
+	}
 	if src := s.source; src != nil {
-		fetchFlags = append(fetchFlags, src.FetchFlags...)
+		// Source flags (e.g. credentials) are git options, which must precede the subcommand.
+		flags, err := opts.exec().fetchFlags(ctx, src)
+		checkSyncStep("resolve credentials", err)
+		fetchFlags = slices.Concat(flags, fetchFlags)
+	}
+	var refs map[string]string
+	if opts.History != nil {
+		refs = s.readRefs()
+	}
+	// Fetches are the most exposed to network failures. We retry them if the failure looks transient.
+	err := opts.Retry.Do(ctx, func() error {
+		return catchSyncStep(func() { s.runGit(ctx, opts, fetchFlags...) })
+	}, isTransientGitError)
+	if err != nil {
+		panic(err)
+	}
+	if opts.History != nil {
+		s.preserveHistory(ctx, opts, refs)
 	}
-	runGitCommand(ctx, s.GitDir, fetchFlags)
 
-	if s.isBare() {
-		// Update HEAD directly so that gitweb shows the most recent remote commit.
-		if ref := s.defaultRemoteRef(); ref != "" {
-			runGitCommand(ctx, s.GitDir, []string{"update-ref", "refs/heads/HEAD", ref})
+	if s.isMirror() {
+		// Branches are fetched directly, we only need to follow changes to the default one.
+		if source := s.source; source != nil && source.DefaultBranch != "" {
+			s.updateHead(ctx, opts, "refs/heads/"+source.DefaultBranch)
 		}
-	} else {
-		if !fileExists(s.gitPath("refs/heads/HEAD")) {
-			// No working directory yet.
-			if source := s.source; source != nil && source.DefaultBranch != "" {
-				runGitCommand(ctx, s.GitDir, []string{"checkout", source.DefaultBranch})
+	} else if s.isBare() {
+		// We maintain a local branch matching the remote default one so that gitweb, cgit, and clones
+		// of the repository show the most recent remote commit.
+		if ref := s.defaultRemoteRef(); ref != "" {
+			refs, err := target.ReadRefs(s.currentGitDir())
+			checkSyncStep("read refs", err)
+			branch := "refs/heads/" + s.source.DefaultBranch
+			s.runGit(ctx, opts, "update-ref", branch, ref)
+			if prev := s.updateHead(ctx, opts, branch); refs[prev] != "" {
+				// The default branch was changed, the previous one is no longer maintained.
+				s.runGit(ctx, opts, "update-ref", "-d", prev)
+			}
+			// Earlier versions used a literal HEAD branch instead.
+			if refs["refs/heads/HEAD"] != "" {
+				s.runGit(ctx, opts, "update-ref", "-d", "refs/heads/HEAD")
 			}
-		} else {
-			runGitCommand(ctx, s.GitDir, []string{"merge", "--ff-only"})
 		}
+	} else {
+		s.updateWorktree(ctx, opts)
 	}
-	slog.Debug("Updated contents.")
+	s.logger().Debug("Updated contents.")
 }
 
-func (s *Syncable) updateMetadata(ctx context.Context) {
+// readHead returns the ref HEAD points to, its object name if detached, or an empty string if the
+// gitdir does not exist yet.
+func (s *Syncable) readHead() string {
+	data, err := os.ReadFile(s.currentGitPath("HEAD"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		checkSyncStep("read HEAD", err)
+	}
+	head, _ := strings.CutPrefix(strings.TrimSpace(string(data)), "ref: ")
+	return head
+}
+
+// updateHead points HEAD to the branch if it does not already, returning the ref it previously
+// pointed to if it changed.
+func (s *Syncable) updateHead(ctx context.Context, opts SyncOptions, branch string) string {
+	prev := s.readHead()
+	if prev == branch {
+		return ""
+	}
+	s.runGit(ctx, opts, "symbolic-ref", "HEAD", branch)
+	return prev
+}
+
+func (s *Syncable) updateMetadata(ctx context.Context, opts SyncOptions) {
 	if source := s.source; source != nil {
-		runGitCommand(ctx, s.GitDir, []string{"config", "set", "gitweb.url", source.FetchURL})
+		s.runGit(ctx, opts, "config", "set", "gitweb.url", source.FetchURL)
 
 		// This allows the remote branches to show up in the summary page's HEADS section.
-		runGitCommand(ctx, s.GitDir, []string{"config", "set", "gitweb.extraBranchRefs", "remotes"})
+		s.runGit(ctx, opts, "config", "set", "gitweb.extraBranchRefs", "remotes")
+
+		// This allows finding the repository again if its source is renamed or transferred.
+		if id := source.ID; id != "" {
+			s.runGit(ctx, opts, "config", "set", sourceIDConfigKey, id)
+		}
+
+		// The repository may have been orphaned in the past, we reset its grace period.
+		if fileExists(s.currentGitPath(orphanMarkerName)) {
+			checkSyncStep("remove orphan marker", opts.exec().removeFile(s.gitPath(orphanMarkerName)))
+		}
 
 		if desc := source.Description; desc != "" {
-			checkSyncStep(os.WriteFile(s.gitPath("description"), []byte(desc), 0644))
+			checkSyncStep("write description", opts.exec().writeFile(s.gitPath("description"), desc))
 		}
 	}
-	slog.Debug("Updated metadata.")
+	s.logger().Debug("Updated metadata.")
 }
 
 var (
 	runGitCommand = func(ctx context.Context, cwd string, args []string) {
 		runCommand(ctx, cwd, "git", args)
 	}
+	readGitCommand = func(ctx context.Context, cwd string, args []string) string {
+		return runCommand(ctx, cwd, "git", args)
+	}
 )
 
+// transientGitErrors are lowercase substrings of git's error messages for failures worth retrying.
+var transientGitErrors = []string{
+	"could not resolve host",
+	"connection reset",
+	"connection timed out",
+	"operation timed out",
+	"the remote end hung up unexpectedly",
+	"early eof",
+	"rpc failed",
+	"unexpected disconnect",
+	"gnutls_handshake() failed",
+	"ssl_error_syscall",
+	"tls connection was non-properly terminated",
+	"the requested url returned error: 429",
+	"the requested url returned error: 5",
+}
+
+func isTransientGitError(err error) bool {
+	var cerr *commandError
+	if !errors.As(err, &cerr) {
+		return false
+	}
+	stderr := strings.ToLower(cerr.stderr)
+	return slices.ContainsFunc(transientGitErrors, func(s string) bool {
+		return strings.Contains(stderr, s)
+	})
+}
+
+// commandError is returned when a command exits unsuccessfully.
+type commandError struct {
+	err    error
+	stderr string
+}
+
+func (e *commandError) Error() string {
+	return fmt.Sprintf("%v: %v", e.err, e.stderr)
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
 func fileExists(fp fspath.POSIX) bool {
 	_, err := os.Stat(fp)
 	return !errors.Is(err, fs.ErrNotExist)
 }
 
-// runCommand executes a command, panicking if it fails.
-func runCommand(ctx context.Context, cwd, name string, args []string) {
+// commandStep names a command after its first argument, or its subcommand for git, which avoids
+// leaking any credentials passed as options.
+func commandStep(name string, args []string) string {
+	if name != "git" {
+		if len(args) > 0 {
+			return name + " " + args[0]
+		}
+		return name
+	}
+	for i := 0; i < len(args); i++ {
+		if args[i] == "-c" {
+			i++ // Skip the option's value.
+		} else if !strings.HasPrefix(args[i], "-") {
+			return name + " " + args[i]
+		}
+	}
+	return name
+}
+
+// nonInteractiveEnv returns environment variables which make git and ssh fail rather than prompt
+// for input, for example credentials. Commands run in their own process group, where reading from
+// the terminal would stop them indefinitely. Any SSH command configured via the environment is
+// left untouched.
+func nonInteractiveEnv() []string {
+	env := []string{"GIT_TERMINAL_PROMPT=0"}
+	if os.Getenv("GIT_SSH_COMMAND") == "" && os.Getenv("GIT_SSH") == "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -o BatchMode=yes")
+	}
+	return env
+}
+
+// runCommand executes a command and returns its standard output, panicking if it fails. The failed
+// step is named by commandStep. If the context is done before the command exits, the command's entire process
+// group is killed.
+func runCommand(ctx context.Context, cwd, name string, args []string) string {
 	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Dir = cwd
+	cmd.Env = append(os.Environ(), nonInteractiveEnv()...)
+	var stdout strings.Builder
+	cmd.Stdout = &stdout
+	killProcessGroupOnCancel(cmd)
 	stderr, err := cmd.StderrPipe()
-	checkSyncStep(err)
-	checkSyncStep(cmd.Start())
+	step := commandStep(name, args)
+	checkSyncStep(step, err)
+	checkSyncStep(step, cmd.Start())
 	errData, _ := io.ReadAll(stderr)
 	if err := cmd.Wait(); err != nil {
-		checkSyncStep(fmt.Errorf("%w: %v", err, string(errData)))
+		if cause := context.Cause(ctx); errors.Is(cause, errCommandTimedOut) {
+			checkSyncStep(step, cause)
+		}
+		checkSyncStep(step, &commandError{err: err, stderr: string(errData)})
 	}
+	return stdout.String()
 }
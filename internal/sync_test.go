@@ -2,15 +2,19 @@ package gitfetcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
 	"github.com/mtth/gitfetcher/internal/effect"
 	"github.com/mtth/gitfetcher/internal/fspath"
+	"github.com/mtth/gitfetcher/internal/retry"
 	"github.com/mtth/gitfetcher/internal/source"
 	"github.com/mtth/gitfetcher/internal/target"
 	"github.com/stretchr/testify/assert"
@@ -47,7 +51,83 @@ func TestSyncable_Sync(t *testing.T) {
 				"config set gitweb.url http://example.com/test",
 				"config set gitweb.extraBranchRefs remotes",
 				"fetch --all",
-				"update-ref refs/heads/HEAD refs/remotes/origin/main",
+				"update-ref refs/heads/main refs/remotes/origin/main",
+				"symbolic-ref HEAD refs/heads/main",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
+		"single mirror missing source": func(t *testing.T, out fmt.Stringer) {
+			root := t.TempDir()
+			syncables, err := GatherSyncables(
+				nil,
+				[]source.Source{{
+					FullName:      "cool/test",
+					FetchURL:      "http://example.com/test",
+					DefaultBranch: "main",
+					Refs:          &source.RefSettings{TagOpt: "--no-tags"},
+				}},
+				root,
+				configpb.Options_MIRROR_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+			assert.Equal(t, filepath.Join(root, "cool/test.git"), syncables[0].GitDir)
+			assert.Equal(t, "mirror", syncables[0].Layout())
+
+			err = syncables[0].Sync(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"init -b main --bare",
+				"remote add --mirror=fetch origin http://example.com/test",
+				"config set remote.origin.mirror true",
+				"config set uploadpack.hideRefs refs/gitfetcher/history/",
+				"config unset --all remote.origin.fetch",
+				"config set --append remote.origin.fetch +refs/*:refs/*",
+				"config set --append remote.origin.fetch ^refs/gitfetcher/history/*",
+				"config set gitweb.url http://example.com/test",
+				"config set gitweb.extraBranchRefs remotes",
+				"fetch --all --prune",
+				"symbolic-ref HEAD refs/heads/main",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
+		"bare source with new default branch": func(t *testing.T, out fmt.Stringer) {
+			root := t.TempDir()
+			gitDir := filepath.Join(root, "cool/renamed.git")
+			for name, data := range map[string]string{
+				"HEAD":               "ref: refs/heads/master\n",
+				"objects/info/.keep": "",
+				"refs/heads/master":  "aaa\n",
+				"refs/heads/HEAD":    "aaa\n",
+			} {
+				fp := filepath.Join(gitDir, filepath.FromSlash(name))
+				require.NoError(t, os.MkdirAll(filepath.Dir(fp), 0755))
+				require.NoError(t, os.WriteFile(fp, []byte(data), 0644))
+			}
+			tgt, err := target.FromPath(gitDir)
+			require.NoError(t, err)
+			syncables, err := GatherSyncables(
+				[]target.Target{tgt},
+				[]source.Source{{
+					FullName:      "cool/renamed",
+					FetchURL:      "http://example.com/renamed",
+					DefaultBranch: "main",
+					LastUpdatedAt: t0,
+				}},
+				root,
+				configpb.Options_BARE_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+
+			err = syncables[0].Sync(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"config set gitweb.url http://example.com/renamed",
+				"config set gitweb.extraBranchRefs remotes",
+				"fetch --all",
+				"update-ref refs/heads/main refs/remotes/origin/main",
+				"symbolic-ref HEAD refs/heads/main",
+				"update-ref -d refs/heads/master",
+				"update-ref -d refs/heads/HEAD",
 			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
 		},
 		"single missing source": func(t *testing.T, out fmt.Stringer) {
@@ -76,6 +156,177 @@ func TestSyncable_Sync(t *testing.T) {
 				"checkout main",
 			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
 		},
+		"partial and shallow clone": func(t *testing.T, out fmt.Stringer) {
+			syncables, err := GatherSyncables(
+				[]target.Target{fakeTarget{path: "/tmp/cool/big"}},
+				[]source.Source{{
+					FullName: "cool/big",
+					FetchURL: "http://example.com/big",
+					Clone:    &source.CloneSettings{Filter: "blob:none", Depth: 10},
+				}},
+				"/tmp",
+				configpb.Options_DEFAULT_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+
+			_, err = SyncAll(ctx, syncables, SyncOptions{
+				Clone: &source.CloneSettings{Filter: "tree:0"},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"config set gitweb.url http://example.com/big",
+				"config set gitweb.extraBranchRefs remotes",
+				"config set remote.origin.promisor true",
+				"config set remote.origin.partialclonefilter blob:none",
+				"fetch --all",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
+		"partial clone credentials": func(t *testing.T, out fmt.Stringer) {
+			syncables, err := GatherSyncables(
+				[]target.Target{fakeTarget{path: "/tmp/cool/private-big"}},
+				[]source.Source{{
+					FullName:      "cool/private-big",
+					FetchURL:      "http://example.com/private-big",
+					DefaultBranch: "main",
+					FetchFlags:    []string{"-c", "credential.helper=secret"},
+					Clone:         &source.CloneSettings{Filter: "blob:none"},
+				}},
+				"/tmp",
+				configpb.Options_DEFAULT_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+
+			err = syncables[0].Sync(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"config set gitweb.url http://example.com/private-big",
+				"config set gitweb.extraBranchRefs remotes",
+				"config set remote.origin.promisor true",
+				"config set remote.origin.partialclonefilter blob:none",
+				"-c credential.helper=secret fetch --all",
+				"-c credential.helper=secret checkout main",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
+		"missing source with refs": func(t *testing.T, out fmt.Stringer) {
+			root := t.TempDir()
+			syncables, err := GatherSyncables(
+				nil,
+				[]source.Source{{
+					FullName: "cool/tags",
+					FetchURL: "http://example.com/tags",
+					Refs: &source.RefSettings{
+						Refspecs: []string{"+refs/heads/main:refs/remotes/origin/main"},
+						TagOpt:   "--tags",
+					},
+				}},
+				root,
+				configpb.Options_BARE_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+
+			err = syncables[0].Sync(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"init --bare",
+				"remote add origin http://example.com/tags",
+				"config unset --all remote.origin.fetch",
+				"config set --append remote.origin.fetch +refs/heads/main:refs/remotes/origin/main",
+				"config set -- remote.origin.tagOpt --tags",
+				"config set gitweb.url http://example.com/tags",
+				"config set gitweb.extraBranchRefs remotes",
+				"fetch --all",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
+		"reconciled refs": func(t *testing.T, out fmt.Stringer) {
+			root := t.TempDir()
+			gitDir := filepath.Join(root, "cool/prs/.git")
+			require.NoError(t, os.MkdirAll(gitDir, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(gitDir, "config"), []byte(`
+[remote "origin"]
+	url = http://example.com/prs
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	tagopt = --no-tags
+`), 0o600))
+			syncables, err := GatherSyncables(
+				[]target.Target{fakeTarget{path: filepath.Join(root, "cool/prs")}},
+				[]source.Source{{
+					FullName: "cool/prs",
+					FetchURL: "http://example.com/prs",
+					Refs: &source.RefSettings{
+						Refspecs: []string{
+							"+refs/heads/*:refs/remotes/origin/*",
+							"+refs/pull/*/head:refs/remotes/origin/pull/*",
+						},
+					},
+				}},
+				root,
+				configpb.Options_DEFAULT_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+
+			err = syncables[0].Sync(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"config unset --all remote.origin.fetch",
+				"config set --append remote.origin.fetch +refs/heads/*:refs/remotes/origin/*",
+				"config set --append remote.origin.fetch +refs/pull/*/head:refs/remotes/origin/pull/*",
+				"config unset remote.origin.tagOpt",
+				"config set gitweb.url http://example.com/prs",
+				"config set gitweb.extraBranchRefs remotes",
+				"fetch --all",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
+		"credentials": func(t *testing.T, out fmt.Stringer) {
+			syncables, err := GatherSyncables(
+				[]target.Target{fakeTarget{path: "/tmp/cool/private"}},
+				[]source.Source{{
+					FullName:   "cool/private",
+					FetchURL:   "http://example.com/private",
+					FetchFlags: []string{"-c", "credential.helper=secret"},
+				}},
+				"/tmp",
+				configpb.Options_DEFAULT_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+
+			err = syncables[0].Sync(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"config set gitweb.url http://example.com/private",
+				"config set gitweb.extraBranchRefs remotes",
+				"-c credential.helper=secret fetch --all",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
+		"source without update time": func(t *testing.T, out fmt.Stringer) {
+			// For example a Bitbucket Data Center repository, which may have been pushed to since.
+			syncables, err := GatherSyncables(
+				[]target.Target{fakeTarget{path: "/tmp/cool/unknown", remoteLastUpdatedAt: t1}},
+				[]source.Source{{
+					FullName:      "cool/unknown",
+					FetchURL:      "http://example.com/unknown",
+					DefaultBranch: "main",
+				}},
+				"/tmp",
+				configpb.Options_DEFAULT_LAYOUT,
+			)
+			require.NoError(t, err)
+			require.Len(t, syncables, 1)
+			assert.Equal(t, SyncStatusUnknown, syncables[0].SyncStatus())
+
+			err = syncables[0].Sync(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, []string{
+				"config set gitweb.url http://example.com/unknown",
+				"config set gitweb.extraBranchRefs remotes",
+				"fetch --all",
+				"checkout main",
+			}, strings.Split(strings.TrimSpace(out.String()), "\n"))
+		},
 		"stale and up-to-date sources": func(t *testing.T, out fmt.Stringer) {
 			syncables, err := GatherSyncables(
 				[]target.Target{fakeTarget{
@@ -128,6 +379,248 @@ func TestSyncable_Sync(t *testing.T) {
 	}
 }
 
+func TestGatherSyncables_renamed(t *testing.T) {
+	root := t.TempDir()
+	gitDir := filepath.Join(root, "old/name.git")
+	for _, dpath := range []string{"objects", "refs"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(gitDir, dpath), 0755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(gitDir, "HEAD"), nil, 0644))
+	config := `[remote "origin"]
+	url = http://example.com/old/name
+	fetch = +refs/heads/*:refs/remotes/origin/*
+[gitfetcher]
+	sourceId = github:example.com:123
+`
+	require.NoError(t, os.WriteFile(filepath.Join(gitDir, "config"), []byte(config), 0644))
+	tgt, err := target.FromPath(gitDir)
+	require.NoError(t, err)
+
+	syncables, err := GatherSyncables(
+		[]target.Target{tgt},
+		[]source.Source{{
+			FullName: "new/name",
+			ID:       "github:example.com:123",
+			FetchURL: "http://example.com/new/name",
+		}},
+		root,
+		configpb.Options_BARE_LAYOUT,
+	)
+	require.NoError(t, err)
+	require.Len(t, syncables, 1)
+	newGitDir := filepath.Join(root, "new/name.git")
+	assert.Equal(t, newGitDir, syncables[0].GitDir)
+
+	actions, err := syncables[0].Plan(context.Background(), SyncOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"mkdir -p " + filepath.Join(root, "new"),
+		fmt.Sprintf("mv %s %s", gitDir, newGitDir),
+		"git remote set-url origin http://example.com/new/name",
+		"git config set gitweb.url http://example.com/new/name",
+		"git config set gitweb.extraBranchRefs remotes",
+		"git config set gitfetcher.sourceId github:example.com:123",
+		"git fetch --all",
+	}, actions)
+
+	t.Run("different host", func(t *testing.T) {
+		syncables, err := GatherSyncables(
+			[]target.Target{tgt},
+			[]source.Source{{
+				FullName: "new/name",
+				ID:       "github:example.com:123",
+				FetchURL: "git@other.example.com:new/name.git",
+			}},
+			root,
+			configpb.Options_BARE_LAYOUT,
+		)
+		require.NoError(t, err)
+		assert.Len(t, syncables, 2)
+	})
+
+	t.Run("different layout", func(t *testing.T) {
+		syncables, err := GatherSyncables(
+			[]target.Target{tgt},
+			[]source.Source{{FullName: "new/name", ID: "github:example.com:123"}},
+			root,
+			configpb.Options_DEFAULT_LAYOUT,
+		)
+		require.NoError(t, err)
+		assert.Len(t, syncables, 2)
+	})
+
+	t.Run("mirror", func(t *testing.T) {
+		root := t.TempDir()
+		gitDir := filepath.Join(root, "old/mirror.git")
+		for _, dpath := range []string{"objects", "refs"} {
+			require.NoError(t, os.MkdirAll(filepath.Join(gitDir, dpath), 0755))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(gitDir, "HEAD"), nil, 0644))
+		config := `[remote "origin"]
+	url = http://example.com/old/mirror
+	fetch = +refs/*:refs/*
+	fetch = ^refs/gitfetcher/history/*
+	mirror = true
+[gitfetcher]
+	sourceId = github:example.com:456
+`
+		require.NoError(t, os.WriteFile(filepath.Join(gitDir, "config"), []byte(config), 0644))
+		tgt, err := target.FromPath(gitDir)
+		require.NoError(t, err)
+
+		syncables, err := GatherSyncables(
+			[]target.Target{tgt},
+			[]source.Source{{
+				FullName:      "new/mirror",
+				ID:            "github:example.com:456",
+				FetchURL:      "http://example.com/new/mirror",
+				DefaultBranch: "main",
+			}},
+			root,
+			configpb.Options_MIRROR_LAYOUT,
+		)
+		require.NoError(t, err)
+		require.Len(t, syncables, 1)
+
+		var cmds []string
+		defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+			cmds = append(cmds, strings.Join(args, " "))
+		})()
+		require.NoError(t, syncables[0].Sync(context.Background()))
+		assert.DirExists(t, filepath.Join(root, "new/mirror.git"))
+		assert.Equal(t, "mirror", syncables[0].Layout())
+		assert.Equal(t, []string{
+			"remote set-url origin http://example.com/new/mirror",
+			"config set gitweb.url http://example.com/new/mirror",
+			"config set gitweb.extraBranchRefs remotes",
+			"config set gitfetcher.sourceId github:example.com:456",
+			"fetch --all --prune",
+			"symbolic-ref HEAD refs/heads/main",
+		}, cmds)
+	})
+}
+
+func TestSyncAll(t *testing.T) {
+	syncables, err := GatherSyncables(
+		[]target.Target{
+			fakeTarget{path: "/tmp/cool/one"},
+			fakeTarget{path: "/tmp/cool/two"},
+			fakeTarget{path: "/tmp/cool/three"},
+		},
+		[]source.Source{
+			{FullName: "cool/one", FetchURL: "http://example.com/one"},
+			{FullName: "cool/two", FetchURL: "http://example.com/two"},
+			{FullName: "cool/three", FetchURL: "http://example.com/three"},
+		},
+		"/tmp",
+		configpb.Options_DEFAULT_LAYOUT,
+	)
+	require.NoError(t, err)
+
+	t.Run("all synced", func(t *testing.T) {
+		var mu sync.Mutex
+		var cwds []string
+		defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+			if args[0] == "fetch" {
+				mu.Lock()
+				defer mu.Unlock()
+				cwds = append(cwds, cwd)
+			}
+		})()
+
+		failures, err := SyncAll(context.Background(), syncables, SyncOptions{Jobs: 2})
+		require.NoError(t, err)
+		assert.Empty(t, failures)
+		assert.ElementsMatch(t, []string{
+			"/tmp/cool/one/.git",
+			"/tmp/cool/two/.git",
+			"/tmp/cool/three/.git",
+		}, cwds)
+	})
+
+	t.Run("failures are collected", func(t *testing.T) {
+		errBoom := errors.New("boom") //nolint:err113
+		defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+			if args[0] == "fetch" && !strings.Contains(cwd, "two") {
+				checkSyncStep("git fetch", errBoom)
+			}
+		})()
+
+		failures, err := SyncAll(context.Background(), syncables, SyncOptions{Jobs: 2})
+		require.NoError(t, err)
+		require.Len(t, failures, 2)
+		assert.Equal(t, "/tmp/cool/one/.git", failures[0].GitDir)
+		assert.Equal(t, "/tmp/cool/three/.git", failures[1].GitDir)
+		for _, failure := range failures {
+			assert.Equal(t, "git fetch", failure.Step)
+			assert.ErrorIs(t, failure, errSyncFailed)
+			assert.ErrorIs(t, failure, errBoom)
+		}
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		var mu sync.Mutex
+		var count int
+		defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+			mu.Lock()
+			defer mu.Unlock()
+			count++
+			checkSyncStep("git config", errors.New("boom")) //nolint:err113
+		})()
+
+		failures, err := SyncAll(context.Background(), syncables, SyncOptions{Jobs: 1, FailFast: true})
+		require.ErrorIs(t, err, errSyncFailed)
+		assert.Empty(t, failures)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("transient fetch failures are retried", func(t *testing.T) {
+		var mu sync.Mutex
+		attempts := make(map[string]int)
+		defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+			if args[0] != "fetch" {
+				return
+			}
+			mu.Lock()
+			attempts[cwd]++
+			n := attempts[cwd]
+			mu.Unlock()
+			if strings.Contains(cwd, "three") {
+				checkSyncStep("git fetch", &commandError{
+					err:    errors.New("exit status 128"), //nolint:err113
+					stderr: "fatal: repository 'http://example.com/three/' not found",
+				})
+			}
+			if n == 1 {
+				checkSyncStep("git fetch", &commandError{
+					err:    errors.New("exit status 128"), //nolint:err113
+					stderr: "error: RPC failed; HTTP 502 curl 22 The requested URL returned error: 502",
+				})
+			}
+		})()
+
+		failures, err := SyncAll(context.Background(), syncables, SyncOptions{
+			Jobs:  2,
+			Retry: retry.Policy{MaxAttempts: 3},
+		})
+		require.NoError(t, err)
+		require.Len(t, failures, 1)
+		assert.Equal(t, "/tmp/cool/three/.git", failures[0].GitDir)
+		assert.Equal(t, map[string]int{
+			"/tmp/cool/one/.git":   2,
+			"/tmp/cool/two/.git":   2,
+			"/tmp/cool/three/.git": 1,
+		}, attempts)
+	})
+
+	t.Run("cancelled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := SyncAll(ctx, syncables, SyncOptions{Jobs: 2})
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
 func TestGetSyncStatus(t *testing.T) {
 	t.Run("missing source", func(t *testing.T) {
 		syncable := Syncable{
@@ -156,6 +649,138 @@ func TestRunCommand(t *testing.T) {
 	t.Run("failed invocation", func(t *testing.T) {
 		require.Panics(t, func() { runCommand(ctx, ".", "false", nil) })
 	})
+
+	t.Run("non-interactive", func(t *testing.T) {
+		t.Setenv("GIT_SSH", "")
+		t.Setenv("GIT_SSH_COMMAND", "")
+		out := runCommand(ctx, ".", "sh", []string{"-c", "echo $GIT_TERMINAL_PROMPT $GIT_SSH_COMMAND"})
+		assert.Equal(t, "0 ssh -o BatchMode=yes\n", out)
+
+		t.Setenv("GIT_SSH_COMMAND", "ssh -i key")
+		out = runCommand(ctx, ".", "sh", []string{"-c", "echo $GIT_SSH_COMMAND"})
+		assert.Equal(t, "ssh -i key\n", out)
+	})
+}
+
+func TestCommandStep(t *testing.T) {
+	for key, tc := range map[string]struct {
+		name string
+		args []string
+		want string
+	}{
+		"no args":        {name: "git", want: "git"},
+		"other command":  {name: "sh", args: []string{"-c", "true"}, want: "sh -c"},
+		"git subcommand": {name: "git", args: []string{"fetch", "--all"}, want: "git fetch"},
+		"git options": {
+			name: "git",
+			args: []string{"-c", "http.extraHeader=Authorization: Bearer abc", "fetch", "--all"},
+			want: "git fetch",
+		},
+	} {
+		t.Run(key, func(t *testing.T) {
+			assert.Equal(t, tc.want, commandStep(tc.name, tc.args))
+		})
+	}
+}
+
+func TestSyncable_shallow(t *testing.T) {
+	ctx := context.Background()
+	for _, key := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_"+key+"_NAME", "Ann")
+		t.Setenv("GIT_"+key+"_EMAIL", "ann@example.com")
+	}
+	root := t.TempDir()
+	upstream := filepath.Join(root, "upstream")
+	require.NoError(t, os.Mkdir(upstream, 0755))
+	git(t, upstream, "init", "-b", "main")
+	commitFile(t, upstream, "a.txt", "1")
+	commitFile(t, upstream, "a.txt", "2")
+	src := source.Source{
+		FullName:      "cool/shallow",
+		FetchURL:      "file://" + filepath.ToSlash(upstream),
+		DefaultBranch: "main",
+		Clone:         &source.CloneSettings{Depth: 1},
+	}
+	workDir := filepath.Join(root, "cool/shallow")
+
+	// We only run the content steps, the metadata ones require a recent version of git.
+	syncContents := func() {
+		t.Helper()
+		var targets []target.Target
+		if tgt, err := target.FromPath(workDir); err == nil && tgt != nil {
+			targets = append(targets, tgt)
+		}
+		syncables, err := GatherSyncables(
+			targets,
+			[]source.Source{src},
+			root,
+			configpb.Options_DEFAULT_LAYOUT,
+		)
+		require.NoError(t, err)
+		require.Len(t, syncables, 1)
+		s := &syncables[0]
+		require.NoError(t, catchSyncStep(func() {
+			if s.SyncStatus() == SyncStatusMissing {
+				s.createTarget(ctx, SyncOptions{})
+			}
+			s.updateContents(ctx, SyncOptions{})
+		}))
+	}
+
+	syncContents()
+	assert.Equal(t, "2", readFile(t, filepath.Join(workDir, "a.txt")))
+	assert.Equal(t, "1", git(t, workDir, "rev-list", "--count", "HEAD"))
+
+	commitFile(t, upstream, "a.txt", "3")
+	syncContents()
+	assert.Equal(t, "3", readFile(t, filepath.Join(workDir, "a.txt")))
+	assert.Equal(t, "2", git(t, workDir, "rev-list", "--count", "HEAD"))
+}
+
+func TestSyncable_timeout(t *testing.T) {
+	defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+		// The background child keeps stderr open, so this only returns early if the whole process
+		// group is killed.
+		runCommand(ctx, ".", "sh", []string{"-c", "sleep 10 & wait"})
+	})()
+
+	var tgt target.Target = fakeTarget{path: t.TempDir()}
+	syncable := Syncable{
+		GitDir: tgt.GitDir(),
+		target: &tgt,
+		source: &source.Source{
+			FetchURL:     "http://example.com/test",
+			FetchTimeout: 50 * time.Millisecond,
+		},
+	}
+	start := time.Now()
+	failures, err := SyncAll(context.Background(), []Syncable{syncable}, SyncOptions{
+		FetchTimeout: time.Hour,
+	})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.Len(t, failures, 1)
+	assert.Equal(t, "sh -c", failures[0].Step)
+	assert.ErrorIs(t, failures[0], errCommandTimedOut)
+	assert.ErrorContains(t, failures[0], "timed out after 50ms")
+}
+
+func TestSyncError(t *testing.T) {
+	defer effect.Swap(&runGitCommand, func(ctx context.Context, cwd string, args []string) {
+		runCommand(ctx, cwd, "false", args)
+	})()
+
+	var tgt target.Target = fakeTarget{path: t.TempDir()}
+	syncable := Syncable{
+		GitDir: tgt.GitDir(),
+		target: &tgt,
+		source: &source.Source{FetchURL: "http://example.com/test"},
+	}
+	err := syncable.Sync(context.Background())
+	var serr *SyncError
+	require.ErrorAs(t, err, &serr)
+	assert.Equal(t, syncable.GitDir, serr.GitDir)
+	assert.Equal(t, "false config", serr.Step)
 }
 
 func TestRunGitCommand(t *testing.T) {
@@ -190,3 +815,17 @@ type fakeTarget struct {
 func (t fakeTarget) GitDir() fspath.Local           { return filepath.Join(t.WorkDir(), ".git") }
 func (t fakeTarget) WorkDir() fspath.Local          { return filepath.FromSlash(t.path) }
 func (t fakeTarget) RemoteLastUpdatedAt() time.Time { return t.remoteLastUpdatedAt }
+
+func TestRemoteHost(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://github.com/ann/one":          "github.com",
+		"https://user@ghe.example.com:8443/a": "ghe.example.com",
+		"git@github.com:ann/one.git":          "github.com",
+		"ssh://git@github.com/ann/one.git":    "github.com",
+		"/srv/git/one.git":                    "",
+	} {
+		t.Run(url, func(t *testing.T) {
+			assert.Equal(t, want, remoteHost(url))
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package target
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/mtth/gitfetcher/internal/fspath"
+)
+
+// Config contains a repository's local git configuration values, keyed by lowercase section,
+// subsection if any, and lowercase name. For example "remote.origin.fetch".
+type Config map[string][]string
+
+// Get returns the last value for a key, or an empty string if absent.
+func (c Config) Get(key string) string {
+	vals := c.GetAll(key)
+	if len(vals) == 0 {
+		return ""
+	}
+	return vals[len(vals)-1]
+}
+
+// GetAll returns all values for a multi-valued key, in order.
+func (c Config) GetAll(key string) []string {
+	return c[normalizeConfigKey(key)]
+}
+
+// normalizeConfigKey lowercases the section and name of a key, preserving its subsection.
+func normalizeConfigKey(key string) string {
+	first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+	if first < 0 {
+		return strings.ToLower(key)
+	}
+	return strings.ToLower(key[:first]) + key[first:last] + strings.ToLower(key[last:])
+}
+
+// ReadConfig parses the gitdir's configuration file. It only handles the simple syntax git itself
+// writes and is not a replacement for git config. A missing file yields an empty configuration.
+func ReadConfig(gitDir fspath.Local) (Config, error) {
+	cfg := make(Config)
+	file, err := fileSystem.Open(unabs(filepath.Join(gitDir, "config")))
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var section string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[':
+			name, sub, ok := strings.Cut(strings.Trim(line, "[]"), " ")
+			section = strings.ToLower(name)
+			if ok {
+				section += "." + strings.Trim(strings.TrimSpace(sub), `"`)
+			}
+		case section != "":
+			name, value, _ := strings.Cut(line, "=")
+			key := section + "." + strings.ToLower(strings.TrimSpace(name))
+			cfg[key] = append(cfg[key], strings.Trim(strings.TrimSpace(value), `"`))
+		}
+	}
+	return cfg, scanner.Err()
+}
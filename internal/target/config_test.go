@@ -0,0 +1,48 @@
+package target
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadConfig(t *testing.T) {
+	defer swapFileSystem(fstest.MapFS{
+		"root/one.git/config": &fstest.MapFile{Data: []byte(`
+[core]
+	bare = true
+# Comment.
+[remote "origin"]
+	url = http://example.com/one
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = ^refs/heads/tmp/*
+[gitfetcher]
+	sourceId = github:123
+	quoted = "a b"
+`)},
+		"root/two.git/HEAD": emptyFile,
+	})()
+
+	t.Run("present", func(t *testing.T) {
+		cfg, err := ReadConfig("/root/one.git")
+		require.NoError(t, err)
+		assert.Equal(t, "true", cfg.Get("core.bare"))
+		assert.Equal(t, "github:123", cfg.Get("gitfetcher.sourceId"))
+		assert.Equal(t, "a b", cfg.Get("gitfetcher.quoted"))
+		assert.Equal(t, "http://example.com/one", cfg.Get("Remote.origin.URL"))
+		assert.Equal(t, []string{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"^refs/heads/tmp/*",
+		}, cfg.GetAll("remote.origin.fetch"))
+		assert.Empty(t, cfg.Get("remote.url"))
+		assert.Empty(t, cfg.Get("core.missing"))
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		cfg, err := ReadConfig("/root/two.git")
+		require.NoError(t, err)
+		assert.Empty(t, cfg)
+	})
+}
@@ -0,0 +1,54 @@
+package target
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mtth/gitfetcher/internal/fspath"
+)
+
+// ReadRefs returns the object names of the gitdir's direct references, keyed by full name (for
+// example refs/heads/main). Symbolic references are omitted.
+func ReadRefs(gitDir fspath.Local) (map[string]string, error) {
+	refs := make(map[string]string)
+
+	// Loose references take precedence over packed ones, so we read the latter first.
+	data, err := fs.ReadFile(fileSystem, unabs(filepath.Join(gitDir, "packed-refs")))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || line[0] == '#' || line[0] == '^' {
+			continue // Comment or peeled tag.
+		}
+		if oid, name, ok := strings.Cut(line, " "); ok {
+			refs[name] = oid
+		}
+	}
+
+	root := unabs(gitDir)
+	refsDir := path.Join(root, "refs")
+	err = fs.WalkDir(fileSystem, refsDir, func(fp fspath.POSIX, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasSuffix(fp, ".lock") {
+			return nil
+		}
+		data, err := fs.ReadFile(fileSystem, fp)
+		if err != nil {
+			return err
+		}
+		if oid := strings.TrimSpace(string(data)); !strings.HasPrefix(oid, "ref:") {
+			refs[strings.TrimPrefix(fp, root+"/")] = oid
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return refs, nil
+}
@@ -0,0 +1,42 @@
+package target
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRefs(t *testing.T) {
+	defer swapFileSystem(fstest.MapFS{
+		"root/one.git/packed-refs": &fstest.MapFile{Data: []byte(`# pack-refs with: peeled fully-peeled sorted
+aaa refs/remotes/origin/main
+bbb refs/remotes/origin/old
+ccc refs/tags/v1
+^ddd
+`)},
+		"root/one.git/refs/remotes/origin/main":     &fstest.MapFile{Data: []byte("eee\n")},
+		"root/one.git/refs/remotes/origin/HEAD":     &fstest.MapFile{Data: []byte("ref: main\n")},
+		"root/one.git/refs/remotes/origin/feat/one": &fstest.MapFile{Data: []byte("fff\n")},
+		"root/one.git/refs/remotes/origin/two.lock": &fstest.MapFile{Data: []byte("ggg\n")},
+		"root/two.git/HEAD":                         emptyFile,
+	})()
+
+	t.Run("loose and packed", func(t *testing.T) {
+		refs, err := ReadRefs("/root/one.git")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"refs/remotes/origin/main":     "eee",
+			"refs/remotes/origin/old":      "bbb",
+			"refs/remotes/origin/feat/one": "fff",
+			"refs/tags/v1":                 "ccc",
+		}, refs)
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		refs, err := ReadRefs("/root/two.git")
+		require.NoError(t, err)
+		assert.Empty(t, refs)
+	})
+}
@@ -37,6 +37,28 @@ func IsBare(tgt Target) bool {
 	return tgt.WorkDir() == ""
 }
 
+// IsMirror returns true iff the input target is a bare repository whose refs are mapped 1:1 with
+// its remote's, as created by git clone --mirror.
+func IsMirror(tgt Target) bool {
+	if !IsBare(tgt) {
+		return false
+	}
+	cfg, err := ReadConfig(tgt.GitDir())
+	if err != nil {
+		slog.Warn("Unable to read target config.", except.LogErrAttr(err))
+		return false
+	}
+	return cfg.Get("remote."+DefaultRemote+".mirror") == "true"
+}
+
+// RootDir returns the target's outermost directory: its work directory if present, else its gitdir.
+func RootDir(tgt Target) fspath.Local {
+	if IsBare(tgt) {
+		return tgt.GitDir()
+	}
+	return tgt.WorkDir()
+}
+
 // realTarget is a filesystem-backed Target implementation.
 type realTarget struct {
 	gitDir, workDir fspath.Local
@@ -50,8 +72,13 @@ func (t realTarget) WorkDir() fspath.Local { return t.workDir }
 
 // LastUpdatedAt implements Target.
 func (t realTarget) RemoteLastUpdatedAt() time.Time {
+	times := remoteRefUpdateTimes(t.gitDir)
+	if IsMirror(t) {
+		// Mirrors store remote refs under their original names.
+		times = refUpdateTimes(filepath.Join(t.gitDir, "refs"))
+	}
 	var maxTime time.Time
-	for _, remoteTime := range remoteRefUpdateTimes(t.gitDir) {
+	for _, remoteTime := range times {
 		if remoteTime.After(maxTime) {
 			maxTime = remoteTime
 		}
@@ -71,8 +98,12 @@ var fileSystem = os.DirFS("/")
 // remoteRefUpdateTimes returns information about the repository's remote git references from a
 // gitdir path.
 func remoteRefUpdateTimes(fpath fspath.Local) map[string]time.Time {
+	return refUpdateTimes(filepath.Join(fpath, "refs", "remotes", DefaultRemote))
+}
+
+// refUpdateTimes returns the update times of loose references under root, keyed by relative path.
+func refUpdateTimes(root fspath.Local) map[string]time.Time {
 	refs := make(map[fspath.Local]time.Time)
-	root := filepath.Join(fpath, "refs", "remotes", DefaultRemote)
 	if err := fs.WalkDir(fileSystem, unabs(root), func(fpath fspath.POSIX, entry fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -90,7 +121,7 @@ func remoteRefUpdateTimes(fpath fspath.Local) map[string]time.Time {
 		}
 		return nil
 	}); err != nil {
-		slog.Warn("Failed to get remote refs.", except.LogErrAttr(err), slog.String("path", fpath))
+		slog.Warn("Failed to get remote refs.", except.LogErrAttr(err), slog.String("path", root))
 	}
 	return refs
 }
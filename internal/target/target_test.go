@@ -49,6 +49,14 @@ func TestTarget_RemoteLastUpdatedAt(t *testing.T) {
 		"root/one.git/refs/remotes/origin/foo/one": &fstest.MapFile{ModTime: t2},
 		"root/one.git/refs/remotes/origin/foo/two": &fstest.MapFile{ModTime: t1},
 		"root/one.git/refs/remotes/other/bar":      &fstest.MapFile{ModTime: t3},
+		"root/two.git/HEAD":                        emptyFile,
+		"root/two.git/objects":                     emptyFile,
+		"root/two.git/config": &fstest.MapFile{
+			Data: []byte("[remote \"origin\"]\n\tmirror = true\n"),
+		},
+		"root/two.git/refs/heads/main":   &fstest.MapFile{ModTime: t1},
+		"root/two.git/refs/tags/v1":      &fstest.MapFile{ModTime: t3},
+		"root/two.git/refs/remotes/x/ys": &fstest.MapFile{ModTime: t2},
 	})()
 
 	t.Run("underlying times ", func(t *testing.T) {
@@ -59,8 +67,16 @@ func TestTarget_RemoteLastUpdatedAt(t *testing.T) {
 	t.Run("method", func(t *testing.T) {
 		tgt, err := FromPath("/root/one.git")
 		require.NoError(t, err)
+		assert.False(t, IsMirror(tgt))
 		assert.Equal(t, t2, tgt.RemoteLastUpdatedAt())
 	})
+
+	t.Run("mirror", func(t *testing.T) {
+		tgt, err := FromPath("/root/two.git")
+		require.NoError(t, err)
+		assert.True(t, IsMirror(tgt))
+		assert.Equal(t, t3, tgt.RemoteLastUpdatedAt())
+	})
 }
 
 var emptyFile = &fstest.MapFile{}
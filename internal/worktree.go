@@ -0,0 +1,173 @@
+package gitfetcher
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/target"
+)
+
+var errWorktreeDiverged = errors.New("worktree diverged from remote")
+
+// committerFlags set the identity of commits created when updating worktrees, so that updates
+// don't fail on hosts which have none configured.
+var committerFlags = []string{
+	"-c", "user.name=gitfetcher",
+	"-c", "user.email=gitfetcher@localhost",
+}
+
+// WorktreeState captures possible states of a local repository's worktree vs its remote default
+// branch.
+type WorktreeState int
+
+//go:generate go run github.com/dmarkham/enumer -type=WorktreeState -trimprefix WorktreeState -transform snake-upper
+
+const (
+	// The worktree's state could not be determined.
+	WorktreeStateUnknown WorktreeState = iota
+	// There is no worktree, either because the repository is bare or nothing was checked out yet.
+	WorktreeStateNone
+	// The worktree can be fast-forwarded to the remote.
+	WorktreeStateClean
+	// Tracked files in the worktree have uncommitted changes.
+	WorktreeStateDirty
+	// The worktree's checked out branch is not the default one or has local commits. This takes
+	// precedence over WorktreeStateDirty.
+	WorktreeStateDiverged
+)
+
+// WorktreeState returns the current WorktreeState of the syncable.
+func (s *Syncable) WorktreeState(ctx context.Context) (WorktreeState, error) {
+	var state WorktreeState
+	err := catchSyncStep(func() { state = s.worktreeState(ctx, SyncOptions{}) })
+	if err != nil {
+		return WorktreeStateUnknown, err
+	}
+	return state, nil
+}
+
+func (s *Syncable) worktreeState(ctx context.Context, opts SyncOptions) WorktreeState {
+	switch {
+	case s.target == nil || s.isBare() || !s.hasCheckout():
+		return WorktreeStateNone
+	case s.isDiverged(ctx, opts):
+		return WorktreeStateDiverged
+	case s.isDirty(ctx, opts):
+		return WorktreeStateDirty
+	default:
+		return WorktreeStateClean
+	}
+}
+
+// hasCheckout returns true iff the worktree's HEAD points to an existing commit.
+func (s *Syncable) hasCheckout() bool {
+	head := s.readHead()
+	if !strings.HasPrefix(head, "refs/") {
+		return head != "" // Detached HEAD.
+	}
+	refs, err := target.ReadRefs(s.currentGitDir())
+	checkSyncStep("read refs", err)
+	_, ok := refs[head]
+	return ok
+}
+
+func (s *Syncable) isDirty(ctx context.Context, opts SyncOptions) bool {
+	return s.readGit(ctx, opts, "status", "--porcelain", "--untracked-files=no") != ""
+}
+
+func (s *Syncable) isDiverged(ctx context.Context, opts SyncOptions) bool {
+	if branch := s.defaultBranch(); branch != "" && s.readHead() != "refs/heads/"+branch {
+		return true
+	}
+	ahead := s.readGit(ctx, opts, "rev-list", "--count", s.upstreamRef()+"..HEAD")
+	return strings.TrimSpace(ahead) != "0"
+}
+
+func (s *Syncable) defaultBranch() string {
+	if src := s.source; src != nil {
+		return src.DefaultBranch
+	}
+	return ""
+}
+
+// upstreamRef returns the remote ref which the worktree is updated to.
+func (s *Syncable) upstreamRef() string {
+	return cmp.Or(s.defaultRemoteRef(), "@{upstream}")
+}
+
+// updateWorktree updates the worktree to its upstream ref, following the source's policy.
+func (s *Syncable) updateWorktree(ctx context.Context, opts SyncOptions) {
+	if !s.hasCheckout() {
+		// No working directory yet.
+		if branch := s.defaultBranch(); branch != "" {
+			s.runCheckoutGit(ctx, opts, "checkout", branch)
+		}
+		return
+	}
+
+	policy := configpb.WorktreePolicy_FF_ONLY_WORKTREE_POLICY
+	if src := s.source; src != nil {
+		policy = src.WorktreePolicy
+	}
+	ref := s.upstreamRef()
+	switch policy {
+	case configpb.WorktreePolicy_FF_ONLY_WORKTREE_POLICY:
+		if s.isDiverged(ctx, opts) {
+			checkSyncStep("update worktree", errWorktreeDiverged)
+		}
+		s.runCheckoutGit(ctx, opts, "merge", "--ff-only", ref)
+	case configpb.WorktreePolicy_HARD_RESET_WORKTREE_POLICY:
+		s.resetWorktree(ctx, opts, ref)
+	case configpb.WorktreePolicy_STASH_RESET_WORKTREE_POLICY:
+		if s.isDirty(ctx, opts) {
+			s.runCommitterGit(ctx, opts, "stash", "push", "--message", "gitfetcher: changes before reset")
+		}
+		s.resetWorktree(ctx, opts, ref)
+	case configpb.WorktreePolicy_SKIP_IF_DIRTY_WORKTREE_POLICY:
+		if state := s.worktreeState(ctx, opts); state != WorktreeStateClean {
+			s.logger().Warn("Skipped worktree update.", slog.String("state", state.String()))
+			return
+		}
+		s.runCheckoutGit(ctx, opts, "merge", "--ff-only", ref)
+	case configpb.WorktreePolicy_REBASE_WORKTREE_POLICY:
+		err := catchSyncStep(func() { s.runCommitterGit(ctx, opts, "rebase", "--autostash", ref) })
+		if err != nil {
+			// We don't leave the worktree in the middle of a rebase, so that later syncs can proceed.
+			if fileExists(s.gitPath("rebase-merge")) || fileExists(s.gitPath("rebase-apply")) {
+				s.runCheckoutGit(ctx, opts, "rebase", "--abort")
+			}
+			panic(err)
+		}
+	}
+}
+
+// runCommitterGit runs a git command which creates commits in the working directory.
+func (s *Syncable) runCommitterGit(ctx context.Context, opts SyncOptions, args ...string) {
+	s.runCheckoutGit(ctx, opts, slices.Concat(committerFlags, args)...)
+}
+
+// runCheckoutGit runs a git command which updates files in the working directory. Partial clones
+// download missing objects from the source when checking them out, so the command is also passed
+// the source's flags (e.g. credentials).
+func (s *Syncable) runCheckoutGit(ctx context.Context, opts SyncOptions, args ...string) {
+	if clone := s.cloneSettings(opts); s.source != nil && clone != nil && clone.Filter != "" {
+		flags, err := opts.exec().fetchFlags(ctx, s.source)
+		checkSyncStep("resolve credentials", err)
+		args = slices.Concat(flags, args)
+	}
+	s.runWorktreeGit(ctx, opts, args...)
+}
+
+// resetWorktree discards all local changes and commits, checking out the ref.
+func (s *Syncable) resetWorktree(ctx context.Context, opts SyncOptions, ref string) {
+	if branch := s.defaultBranch(); branch != "" {
+		s.runCheckoutGit(ctx, opts, "checkout", "--force", "-B", branch, ref)
+	} else {
+		s.runCheckoutGit(ctx, opts, "reset", "--hard", ref)
+	}
+}
@@ -0,0 +1,185 @@
+package gitfetcher
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	configpb "github.com/mtth/gitfetcher/internal/configpb_gen"
+	"github.com/mtth/gitfetcher/internal/effect"
+	"github.com/mtth/gitfetcher/internal/source"
+	"github.com/mtth/gitfetcher/internal/target"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+func commitFile(t *testing.T, dir, name, contents string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0644))
+	git(t, dir, "add", name)
+	git(t, dir, "commit", "-m", "Update "+name)
+}
+
+// newWorktreeFixture returns the worktree of a clone and a syncable for it. The clone has fetched
+// a new upstream commit which changed a.txt from 1 to 2.
+func newWorktreeFixture(t *testing.T, policy configpb.WorktreePolicy) (string, *Syncable) {
+	for _, key := range []string{"AUTHOR", "COMMITTER"} {
+		t.Setenv("GIT_"+key+"_NAME", "Ann")
+		t.Setenv("GIT_"+key+"_EMAIL", "ann@example.com")
+	}
+	root := t.TempDir()
+	upstream := filepath.Join(root, "upstream")
+	require.NoError(t, os.Mkdir(upstream, 0755))
+	git(t, upstream, "init", "-b", "main")
+	commitFile(t, upstream, "a.txt", "1")
+	git(t, root, "clone", upstream, "clone")
+	commitFile(t, upstream, "a.txt", "2")
+	workDir := filepath.Join(root, "clone")
+	git(t, workDir, "fetch")
+
+	tgt, err := target.FromPath(workDir)
+	require.NoError(t, err)
+	return workDir, &Syncable{
+		GitDir: tgt.GitDir(),
+		target: &tgt,
+		source: &source.Source{
+			FullName:       "cool/clone",
+			DefaultBranch:  "main",
+			WorktreePolicy: policy,
+		},
+	}
+}
+
+func readFile(t *testing.T, fp string) string {
+	data, err := os.ReadFile(fp)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSyncable_updateWorktree(t *testing.T) {
+	ctx := context.Background()
+
+	updateWorktree := func(s *Syncable) error {
+		return catchSyncStep(func() { s.updateWorktree(ctx, SyncOptions{}) })
+	}
+
+	t.Run("fast-forward", func(t *testing.T) {
+		workDir, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_FF_ONLY_WORKTREE_POLICY)
+		state, err := syncable.WorktreeState(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, WorktreeStateClean, state)
+
+		require.NoError(t, updateWorktree(syncable))
+		assert.Equal(t, "2", readFile(t, filepath.Join(workDir, "a.txt")))
+	})
+
+	t.Run("fast-forward diverged", func(t *testing.T) {
+		workDir, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_FF_ONLY_WORKTREE_POLICY)
+		commitFile(t, workDir, "b.txt", "local")
+		state, err := syncable.WorktreeState(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, WorktreeStateDiverged, state)
+
+		assert.ErrorIs(t, updateWorktree(syncable), errWorktreeDiverged)
+		assert.Equal(t, "1", readFile(t, filepath.Join(workDir, "a.txt")))
+	})
+
+	t.Run("hard reset", func(t *testing.T) {
+		workDir, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_HARD_RESET_WORKTREE_POLICY)
+		git(t, workDir, "checkout", "-b", "other")
+		commitFile(t, workDir, "b.txt", "local")
+		require.NoError(t, os.WriteFile(filepath.Join(workDir, "a.txt"), []byte("dirty"), 0644))
+
+		require.NoError(t, updateWorktree(syncable))
+		assert.Equal(t, "2", readFile(t, filepath.Join(workDir, "a.txt")))
+		assert.NoFileExists(t, filepath.Join(workDir, "b.txt"))
+		assert.Equal(t, "main", git(t, workDir, "branch", "--show-current"))
+	})
+
+	t.Run("stash and reset", func(t *testing.T) {
+		workDir, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_STASH_RESET_WORKTREE_POLICY)
+		require.NoError(t, os.WriteFile(filepath.Join(workDir, "a.txt"), []byte("dirty"), 0644))
+		state, err := syncable.WorktreeState(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, WorktreeStateDirty, state)
+
+		require.NoError(t, updateWorktree(syncable))
+		assert.Equal(t, "2", readFile(t, filepath.Join(workDir, "a.txt")))
+		assert.Contains(t, git(t, workDir, "stash", "list"), "gitfetcher")
+	})
+
+	t.Run("skip if dirty", func(t *testing.T) {
+		workDir, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_SKIP_IF_DIRTY_WORKTREE_POLICY)
+		require.NoError(t, os.WriteFile(filepath.Join(workDir, "a.txt"), []byte("dirty"), 0644))
+
+		require.NoError(t, updateWorktree(syncable))
+		assert.Equal(t, "dirty", readFile(t, filepath.Join(workDir, "a.txt")))
+	})
+
+	t.Run("rebase", func(t *testing.T) {
+		workDir, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_REBASE_WORKTREE_POLICY)
+		commitFile(t, workDir, "b.txt", "local")
+
+		require.NoError(t, updateWorktree(syncable))
+		assert.Equal(t, "2", readFile(t, filepath.Join(workDir, "a.txt")))
+		assert.Equal(t, "local", readFile(t, filepath.Join(workDir, "b.txt")))
+	})
+
+	t.Run("rebase conflict", func(t *testing.T) {
+		workDir, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_REBASE_WORKTREE_POLICY)
+		commitFile(t, workDir, "a.txt", "local")
+
+		require.Error(t, updateWorktree(syncable))
+		assert.Equal(t, "local", readFile(t, filepath.Join(workDir, "a.txt")))
+		assert.NoDirExists(t, filepath.Join(workDir, ".git/rebase-merge"))
+	})
+
+	t.Run("partial clone credentials", func(t *testing.T) {
+		_, syncable := newWorktreeFixture(t, configpb.WorktreePolicy_FF_ONLY_WORKTREE_POLICY)
+		syncable.source.FetchFlags = []string{"-c", "credential.helper=secret"}
+		syncable.source.Clone = &source.CloneSettings{Filter: "blob:none"}
+		var cmds []string
+		defer effect.Swap(&runGitCommand, func(_ context.Context, _ string, args []string) {
+			cmds = append(cmds, strings.Join(args, " "))
+		})()
+
+		require.NoError(t, updateWorktree(syncable))
+		assert.Equal(t, []string{
+			"-c credential.helper=secret merge --ff-only refs/remotes/origin/main",
+		}, cmds)
+	})
+
+	t.Run("without identity", func(t *testing.T) {
+		for _, policy := range []configpb.WorktreePolicy{
+			configpb.WorktreePolicy_STASH_RESET_WORKTREE_POLICY,
+			configpb.WorktreePolicy_REBASE_WORKTREE_POLICY,
+		} {
+			workDir, syncable := newWorktreeFixture(t, policy)
+			commitFile(t, workDir, "b.txt", "local")
+			require.NoError(t, os.WriteFile(filepath.Join(workDir, "b.txt"), []byte("dirty"), 0644))
+			for _, key := range []string{"AUTHOR", "COMMITTER"} {
+				require.NoError(t, os.Unsetenv("GIT_"+key+"_NAME"))
+				require.NoError(t, os.Unsetenv("GIT_"+key+"_EMAIL"))
+			}
+			t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+			t.Setenv("GIT_CONFIG_COUNT", "1")
+			t.Setenv("GIT_CONFIG_KEY_0", "user.useConfigOnly")
+			t.Setenv("GIT_CONFIG_VALUE_0", "true")
+
+			require.NoError(t, updateWorktree(syncable), policy)
+			assert.Equal(t, "2", readFile(t, filepath.Join(workDir, "a.txt")))
+		}
+	})
+}